@@ -0,0 +1,75 @@
+package popen
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Default backoff parameters of Supervisor and Retry.
+const (
+	DefaultInitialBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff        = 30 * time.Second
+	DefaultBackoffMultiplier = 2.0
+)
+
+// backoff computes exponentially increasing delays between consecutive
+// attempts, with optional jitter.
+type backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+}
+
+// newBackoff returns a backoff with the specified parameters, substituting
+// defaults for unset values.
+func newBackoff(initial, max time.Duration, multiplier, jitter float64) backoff {
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = DefaultBackoffMultiplier
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return backoff{initial, max, multiplier, jitter}
+}
+
+// next returns the delay following previous, or the initial delay if previous
+// is zero.
+func (b backoff) next(previous time.Duration) time.Duration {
+	if previous == 0 {
+		return b.initial
+	}
+	var next = time.Duration(float64(previous) * b.multiplier)
+	if next > b.max {
+		next = b.max
+	}
+	return next
+}
+
+// randomize applies the jitter of the backoff to delay.
+func (b backoff) randomize(delay time.Duration) time.Duration {
+	if b.jitter <= 0 {
+		return delay
+	}
+	return time.Duration(float64(delay) * (1 + b.jitter*(2*rand.Float64()-1)))
+}
+
+// sleep waits for delay, or until ctx becomes done, and returns the context
+// error in the latter case.
+func sleep(ctx context.Context, delay time.Duration) error {
+	var timer = time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
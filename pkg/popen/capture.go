@@ -0,0 +1,88 @@
+package popen
+
+import (
+	"strings"
+
+	"github.com/maargenton/go-errors"
+)
+
+// ErrOutputLimitExceeded is a sentinel error returned when a command is aborted
+// because its captured output exceeds `MaxStdoutBytes` or `MaxStderrBytes`,
+// with the `AbortOnOverflow` policy.
+var ErrOutputLimitExceeded = errors.Sentinel("ErrOutputLimitExceeded")
+
+// OverflowPolicy defines what happens when the captured output of a command
+// exceeds its limit, as defined by `MaxStdoutBytes` or `MaxStderrBytes`.
+type OverflowPolicy int
+
+const (
+	// KeepHead retains the beginning of the output, up to the limit, and drops
+	// the rest. This is the default policy.
+	KeepHead OverflowPolicy = iota
+
+	// KeepTail retains the end of the output, up to the limit, and drops the
+	// beginning.
+	KeepTail
+
+	// AbortOnOverflow retains the beginning of the output, up to the limit,
+	// and aborts the command as soon as the limit is exceeded, through the same
+	// shutdown sequence as when the context becomes done. The returned error
+	// then matches `ErrOutputLimitExceeded`.
+	AbortOnOverflow
+)
+
+// captureBuffer is an io.Writer that captures an output stream of a command,
+// up to an optional limit, according to an overflow policy. The zero value
+// captures the whole stream.
+type captureBuffer struct {
+	max     int
+	policy  OverflowPolicy
+	onAbort func()
+
+	head    strings.Builder
+	tail    *tailBuffer
+	dropped int64
+	aborted bool
+}
+
+func (b *captureBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	switch {
+	case b.max <= 0:
+		b.head.Write(p)
+
+	case b.policy == KeepTail:
+		if b.tail == nil {
+			b.tail = newTailBuffer(b.max)
+		}
+		b.tail.Write(p)
+
+	default:
+		if room := b.max - b.head.Len(); len(p) > room {
+			b.dropped += int64(len(p) - room)
+			p = p[:room]
+			if b.policy == AbortOnOverflow && !b.aborted {
+				b.aborted = true
+				b.onAbort()
+			}
+		}
+		b.head.Write(p)
+	}
+	return
+}
+
+// String returns the captured content of the stream.
+func (b *captureBuffer) String() string {
+	if b.tail != nil {
+		return b.tail.String()
+	}
+	return b.head.String()
+}
+
+// Dropped returns the number of bytes of the stream that were not captured.
+func (b *captureBuffer) Dropped() int64 {
+	if b.tail != nil {
+		return b.tail.Dropped()
+	}
+	return b.dropped
+}
@@ -0,0 +1,67 @@
+package popen_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestCommandMaxStdoutBytesKeepHead(t *testing.T) {
+	var cmd = popen.Command{
+		Command:        "bash",
+		Arguments:      []string{"-c", "echo 0123456789; echo abcdefghij"},
+		MaxStdoutBytes: 8,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, result.Stdout).Eq("01234567")
+	verify.That(t, result.StdoutTruncated).IsTrue()
+	verify.That(t, result.StdoutDroppedBytes).Eq(int64(14))
+	verify.That(t, result.StderrTruncated).IsFalse()
+	verify.That(t, result.StderrDroppedBytes).Eq(int64(0))
+}
+
+func TestCommandMaxStderrBytesKeepTail(t *testing.T) {
+	var cmd = popen.Command{
+		Command:        "bash",
+		Arguments:      []string{"-c", "echo 0123456789 >&2; echo abcdefghij >&2"},
+		MaxStderrBytes: 8,
+		StderrOverflow: popen.KeepTail,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, result.Stderr).Eq("defghij\n")
+	verify.That(t, result.StderrTruncated).IsTrue()
+	verify.That(t, result.StderrDroppedBytes).Eq(int64(14))
+}
+
+func TestCommandMaxStdoutBytesWithinLimit(t *testing.T) {
+	var cmd = popen.Command{
+		Command:        "bash",
+		Arguments:      []string{"-c", "echo 0123456789"},
+		MaxStdoutBytes: 11,
+		StdoutOverflow: popen.AbortOnOverflow,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, result.Stdout).Eq("0123456789\n")
+	verify.That(t, result.StdoutTruncated).IsFalse()
+}
+
+func TestCommandMaxStdoutBytesAbortOnOverflow(t *testing.T) {
+	var cmd = popen.Command{
+		Command:        "bash",
+		Arguments:      []string{"-c", "echo 0123456789; sleep 10"},
+		MaxStdoutBytes: 8,
+		StdoutOverflow: popen.AbortOnOverflow,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(popen.ErrOutputLimitExceeded)
+	verify.That(t, err).ToString().Contains("stdout of command 'bash' exceeded 8 bytes")
+	verify.That(t, result.Stdout).Eq("01234567")
+	verify.That(t, result.StdoutTruncated).IsTrue()
+	verify.That(t, result.Duration.Seconds()).Lt(5.0)
+}
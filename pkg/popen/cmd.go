@@ -2,11 +2,14 @@ package popen
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -16,11 +19,15 @@ import (
 // redirected. Unlike exec.Command, all the details of the command to run and
 // what to do with its outputs are captured in public fields of the `Command`
 // structure. The output streams, stdout and stderr, can be returned as a
-// string, redirected to a file or stream-processed through an `io.Reader`.
+// string, redirected to a file or an `io.Writer`, stream-processed through an
+// `io.Reader`, line by line or as JSON records, and recorded together as
+// combined output. The environment of the command can be derived from the
+// current one through `Environment`, and its execution observed through
+// `Hooks`.
 //
-// Except for `StdoutReader` and `StderrReader` which are most likely stateful,
-// the command object is stateless and can potentially be `Run()` multiple
-// times, concurrently.
+// Except for the reader, line and JSON handlers and the writers, which are
+// most likely stateful, the command object is stateless and can potentially be
+// `Run()` multiple times, concurrently.
 type Command struct {
 	// Directory if specified will be used as the working directory while
 	// running the command, instead of the current working directory.
@@ -30,6 +37,17 @@ type Command struct {
 	// path.
 	Command string
 
+	// FallbackCommands is an optional list of alternate names or paths of the
+	// command to execute, tried in order if `Command` is not found.
+	FallbackCommands []string
+
+	// SearchPath, if specified, is the list of directories, separated by
+	// `os.PathListSeparator`, searched for the command executable. By default,
+	// the PATH variable of the environment of the command is used if defined,
+	// or the PATH of the current process otherwise. Relative directories are
+	// ignored.
+	SearchPath string
+
 	// Arguments is the list of arguments to pass to the command. They are
 	// passed as is, without any shell expansion.
 	Arguments []string
@@ -43,46 +61,154 @@ type Command struct {
 	// process environment
 	OverwriteEnv bool
 
+	// Environment, if specified, defines additional changes to the environment
+	// of the command, applied on top of the inherited environment and `Env`.
+	// The resulting environment is passed to the command sorted by variable
+	// name, without duplicates; see `EffectiveEnv()`.
+	Environment *Environment
+
 	// Stdin, if not empty, will be written to the stdin input of the command.
 	// It is ignored if either `ReadStdinFromFile` or `StdinWriter` are
 	// specified.
-	// Stdin string
+	Stdin string
 
 	// ReadStdinFromFile if not empty causes the stdin input of the command to
-	// be fed with the cntent of the file specified. If takes precedence over
+	// be fed with the content of the file specified. If takes precedence over
 	// `Stdin`, but is ignored if `StdinWriter` specified.
-	// ReadStdinFromFile string
+	ReadStdinFromFile string
 
 	// StdinWriter is a function expected to write the content of the command
-	// stdin input to its argument w. Once it retruns, the command stdin is
+	// stdin input to its argument w. Once it returns, the command stdin is
 	// closed. The command is aborted if an error is returned. StdinWriter takes
 	// precedence of both `Stdin` and `ReadStdinFromFile`.
-	// StdinWriter func(w io.Writer) error
+	StdinWriter func(w io.Writer) error
 
 	// DiscardStdout causes the stdout stream of the child process to not be
 	// captured or returned as stdout.
 	DiscardStdout bool
 
+	// MaxStdoutBytes, if non-zero, limits the size of the stdout content
+	// captured and returned as stdout, according to `StdoutOverflow`. The
+	// other stdout options are not affected.
+	MaxStdoutBytes int
+
+	// StdoutOverflow defines what happens when the captured stdout content
+	// exceeds `MaxStdoutBytes`. It defaults to `KeepHead`.
+	StdoutOverflow OverflowPolicy
+
 	// WriteStdoutToFile if not empty causes the stdout stream of the command to
 	// be written to the specified file, instead of being captured into Stdout.
 	WriteStdoutToFile string
 
+	// StdoutFileMode defines how `WriteStdoutToFile` is written: truncated by
+	// default, appended to, or atomically replaced if the command succeeds.
+	StdoutFileMode OutputFileMode
+
+	// StdoutWriter if specified receives the content of the command stdout
+	// stream, in addition to any other stdout option. It is not closed by the
+	// command, even if it is an *os.File. An *os.File that is the only
+	// destination of the stdout stream, e.g. with `DiscardStdout`, is passed
+	// directly to the child process as its stdout.
+	StdoutWriter io.Writer
+
 	// StdoutReader if specified is expected to read the content of the command
 	// stdout stream from w. If it returns an error, the command is aborted.
 	StdoutReader func(r io.Reader) error
 
+	// StdoutLineHandler if specified is called once for each line of the
+	// command stdout stream, without the line terminator. If it returns an
+	// error, the command is aborted.
+	StdoutLineHandler func(line string) error
+
+	// StdoutJSONHandler if specified is called once for each JSON record of
+	// the command stdout stream, typically newline-delimited JSON, as soon as
+	// the record is complete. If the stream cannot be decoded or if it returns
+	// an error, the command is aborted.
+	StdoutJSONHandler func(record json.RawMessage) error
+
 	// DiscardStderr causes the stderr stream of the child process to not be
 	// captured or returned as stderr.
 	DiscardStderr bool
 
+	// MaxStderrBytes, if non-zero, limits the size of the stderr content
+	// captured and returned as stderr, according to `StderrOverflow`. The
+	// other stderr options are not affected.
+	MaxStderrBytes int
+
+	// StderrOverflow defines what happens when the captured stderr content
+	// exceeds `MaxStderrBytes`. It defaults to `KeepHead`.
+	StderrOverflow OverflowPolicy
+
 	// WriteStderrToFile if not empty causes the stderr stream of the command to
 	// be written to the specified file, instead of being captured into Stderr.
 	WriteStderrToFile string
 
+	// StderrFileMode defines how `WriteStderrToFile` is written: truncated by
+	// default, appended to, or atomically replaced if the command succeeds.
+	StderrFileMode OutputFileMode
+
+	// StderrWriter if specified receives the content of the command stderr
+	// stream, in addition to any other stderr option. It is not closed by the
+	// command, even if it is an *os.File. An *os.File that is the only
+	// destination of the stderr stream, e.g. with `DiscardStderr`, is passed
+	// directly to the child process as its stderr.
+	StderrWriter io.Writer
+
 	// StderrReader if specified is expected to read the content of the command
 	// stderr stream from w. If it returns an error, the command is aborted.
 	StderrReader func(r io.Reader) error
 
+	// StderrLineHandler if specified is called once for each line of the
+	// command stderr stream, without the line terminator. If it returns an
+	// error, the command is aborted.
+	StderrLineHandler func(line string) error
+
+	// CreateOutputDirs causes any missing parent directory of
+	// `WriteStdoutToFile` and `WriteStderrToFile` to be created, like
+	// `fileutils.Touch()` does.
+	CreateOutputDirs bool
+
+	// MaxLineLength is the maximum length in bytes of the lines passed to
+	// `StdoutLineHandler` and `StderrLineHandler`; longer lines are split and
+	// passed in multiple calls. It defaults to `DefaultMaxLineLength` if not
+	// set explicitly.
+	MaxLineLength int
+
+	// DiscardUnterminatedLine causes the last line of the stdout and stderr
+	// streams to not be passed to `StdoutLineHandler` and `StderrLineHandler`
+	// if it is not terminated by a newline character.
+	DiscardUnterminatedLine bool
+
+	// CombinedOutput causes every chunk written by the command to stdout or
+	// stderr to be recorded in order, tagged with its stream and the time it
+	// was received, and returned in the `Output` field of the result. This
+	// does not affect the other output options. Chunks are recorded as they
+	// are read from each stream, so the relative order of writes by the
+	// command is preserved as long as they are far enough apart in time.
+	CombinedOutput bool
+
+	// WriteCombinedOutputToFile if not empty causes the chunks recorded as with
+	// `CombinedOutput` to be written to the specified file, in the format
+	// described by `WriteCombinedOutput()`, as they are received.
+	WriteCombinedOutputToFile string
+
+	// StderrTailBytes, if non-zero, causes up to that many bytes from the end
+	// of the stderr stream to be retained, regardless of the other stderr
+	// options, and a non-zero exit status of the command to be reported as an
+	// *ExitError that includes that tail of stderr.
+	StderrTailBytes int
+
+	// StderrTailLines, if non-zero, limits the tail of stderr included in the
+	// returned *ExitError to that many lines. If `StderrTailBytes` is not set,
+	// up to `DefaultStderrTailBytes` bytes are retained.
+	StderrTailLines int
+
+	// IdleTimeout, if non-zero, causes the command to be shut down, through the
+	// same sequence as when the context becomes done, if neither stdout nor
+	// stderr produce any output for that long. The returned error then matches
+	// `ErrIdleTimeout`.
+	IdleTimeout time.Duration
+
 	// ShutdownGracePeriod, if specified, changes the context handling
 	// mechanism. By default, if the context becomes done before the command
 	// completes, the child process is killed. If ShutdownGracePeriod is
@@ -99,6 +225,16 @@ type Command struct {
 	// unix signals.
 	ShutdownSignal syscall.Signal
 
+	// ShutdownSequence, if specified, defines an escalating shutdown sequence
+	// to apply instead of `ShutdownGracePeriod` and `ShutdownSignal` when the
+	// context becomes done before the command completes. The signal of each
+	// step is sent in turn to the child process, followed by a wait for the
+	// process to exit, and the process is killed if it is still running after
+	// the last step. `ShutdownGracePeriod` and `ShutdownSignal` are a shorthand
+	// for a single-step sequence. This field is ignored on Windows which does
+	// not implement unix signals.
+	ShutdownSequence []ShutdownStep
+
 	// NoProcessGroup when true prevents the command for create a separate
 	// process group for the child process. By default the child process is
 	// created in its own process group, and signals are sent to the whole group
@@ -109,147 +245,391 @@ type Command struct {
 	// os.Process.Wait() will keep waiting for all descendants to exit. This
 	// field is ignored on Windows which does not implement unix signals.
 	NoProcessGroup bool
+
+	// Credential, if specified, sets the user and group ids of the child
+	// process, typically to drop privileges when running as root. This field
+	// is ignored on Windows.
+	Credential *Credential
+
+	// ParentDeathSignal, if non-zero, is the signal sent to the child process
+	// when the OS thread that called `Run()` or `Start()` exits, rather than
+	// when the current process dies. The Go runtime may terminate threads
+	// during the lifetime of the process; callers that need a reliable signal
+	// should start the command from a goroutine locked with
+	// `runtime.LockOSThread()` that remains alive as long as the child
+	// process. This field is supported on Linux only and ignored on other
+	// platforms.
+	ParentDeathSignal syscall.Signal
+
+	// Rlimits is an optional list of resource limits applied to the child
+	// process through prlimit(2), right after it starts. The limits are
+	// applied concurrently with the program of the child process, which can
+	// briefly run without them, e.g. allocate memory or fork processes that
+	// keep the previous limits. The command fails to start if any limit cannot
+	// be applied. This field is supported on Linux only; it causes an error on
+	// other unix platforms and is ignored on Windows.
+	Rlimits []Rlimit
+
+	// Nice, if non-zero, is the scheduling priority applied to the child
+	// process through setpriority(2), right after it starts, concurrently with
+	// its program like `Rlimits`. The command fails to start if the priority
+	// cannot be applied, typically when raising it without privileges. This
+	// field is ignored on Windows.
+	Nice int
+
+	// UsePTY causes the child process to be attached to a new pseudo-terminal,
+	// as its stdin, stdout and stderr, for commands that behave differently
+	// when not connected to a terminal. The stdin input of the command is
+	// written into the terminal, followed by an end-of-file character, and the
+	// output of the terminal is passed to the stdout outputs of the command;
+	// the stderr outputs receive nothing. As with any terminal, the input is
+	// echoed back and newlines in the output are translated to CR-LF. This
+	// field is supported on Linux only, with the default runner, and causes an
+	// error on other platforms.
+	UsePTY bool
+
+	// PTYRows and PTYCols define the window size of the pseudo-terminal when
+	// `UsePTY` is set. They default to `DefaultPTYRows` and `DefaultPTYCols`
+	// if not set explicitly.
+	PTYRows int
+	PTYCols int
+
+	// ExtraFiles specifies additional open files inherited by the child
+	// process, as file descriptors 3 and up, in order. Each entry either
+	// passes an existing file, or a pipe whose content is read by a reader
+	// servicer. Extra files are not supported on Windows.
+	ExtraFiles []ExtraFile
+
+	// Runner, if specified, is used to execute the command instead of
+	// `DefaultRunner`.
+	Runner Runner
+
+	// Hooks, if specified, are invoked at various stages of the execution of
+	// the command, after any hooks registered with `RegisterHooks()`.
+	Hooks *Hooks
 }
 
 // Run executes the command as specified and returns the captured content of
 // stdout and stderr if not discarded. If the process is executed successfully
-// but returns a non-zero exit status, the returned error is an exec.ExitError
-// that contains the actual status code.
+// but returns a non-zero exit status, the returned error is or wraps an
+// *exec.ExitError that contains the actual status code, and can be matched
+// with `errors.As()`. It is wrapped into an *ExitError if `StderrTailBytes` or
+// `StderrTailLines` is set. With an alternate `Runner`, the exit error is the
+// one reported by that runner.
 func (c *Command) Run(ctx context.Context) (stdout, stderr string, err error) {
+	p, err := c.Start(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return p.Wait()
+}
+
+// execution captures the state associated with a single run of a command,
+// from the configuration of its invocation to the collection of its outputs.
+type execution struct {
+	// Accessed atomically; kept first for 64-bit alignment on 32-bit platforms
+	lastActivity int64
+	idleTimedOut int32
+
+	c      *Command
+	inv    Invocation
+	handle Handle
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex     sync.Mutex
+	sequence  []ShutdownStep
+	startTime time.Time
+
+	closeAfterWait    []io.Closer
+	closeAfterStart   []io.Closer
+	closeIfNotStarted []io.Closer
+	finalizers        []func(err error) error
+	servicers         []func()
+	servicerErrors    chan error
+
+	stdoutBuf captureBuffer
+	stderrBuf captureBuffer
+	combined  *combinedOutput
+	hooks     []*Hooks
+
+	stderrTail *tailBuffer
+}
+
+// prepare creates a new execution of the command, with its inputs and outputs
+// configured according to the command options. If specified, `stdin` and
+// `stdout` override the corresponding options of the command and are connected
+// directly to the child process; they are closed once no longer needed.
+func (c *Command) prepare(ctx context.Context, stdin, stdout *os.File) (_ *execution, err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
 
-	var cmd = exec.Command(c.Command, c.Arguments...)
-	var closeAfterWait []io.Closer
-	var servicers []func()
-	var servicerErrors chan error
+	var e = &execution{
+		c:      c,
+		ctx:    ctx,
+		cancel: cancel,
 
-	// Setup environment
-	if c.Directory != "" {
-		cmd.Dir = c.Directory
+		sequence: c.shutdownSequence(),
+		hooks:    c.effectiveHooks(),
+	}
+	e.stdoutBuf = captureBuffer{max: c.MaxStdoutBytes, policy: c.StdoutOverflow, onAbort: cancel}
+	e.stderrBuf = captureBuffer{max: c.MaxStderrBytes, policy: c.StderrOverflow, onAbort: cancel}
+	e.inv = Invocation{
+		Context: ctx,
+		Command: c,
+		e:       e,
+	}
+	defer func() {
+		if err != nil {
+			e.closeStartFiles(false)
+			e.close()
+			e.finalize(err)
+			e.cancel()
+		}
+	}()
+
+	var inv = &e.inv
+	for _, f := range []*os.File{stdin, stdout} {
+		if f != nil {
+			e.closeAfterWait = append(e.closeAfterWait, f)
+		}
 	}
 
-	if len(c.Env) > 0 {
-		var env []string
-		if !c.OverwriteEnv {
-			env = os.Environ()
+	// Setup environment
+	inv.Env = c.effectiveEnv()
+
+	// Setup combined output
+	if c.CombinedOutput || c.WriteCombinedOutputToFile != "" || hasOutputChunkHook(e.hooks) {
+		// Output chunks are held until the OnStart hooks have returned
+		e.combined = &combinedOutput{
+			record:  c.CombinedOutput,
+			onChunk: e.onOutputChunk,
+			hold:    hasOutputChunkHook(e.hooks),
+		}
+		if c.WriteCombinedOutputToFile != "" {
+			f, err := e.openOutputFile("combined output", c.WriteCombinedOutputToFile, TruncateFile)
+			if err != nil {
+				return nil, err
+			}
+			e.combined.w = f
 		}
-		cmd.Env = append(env, c.Env...)
 	}
 
 	// Configure stdout
 	var stdoutStreams []io.Writer
-	if c.WriteStdoutToFile != "" {
-		f, err := os.OpenFile(
-			c.WriteStdoutToFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
-			return "", "", fmt.Errorf(
-				"failed to open stdout file '%v': %w",
-				c.WriteStdoutToFile, err)
+	if stdout != nil {
+		stdoutStreams = append(stdoutStreams, stdout)
+	} else {
+		if c.WriteStdoutToFile != "" {
+			f, err := e.openOutputFile("stdout", c.WriteStdoutToFile, c.StdoutFileMode)
+			if err != nil {
+				return nil, err
+			}
+			stdoutStreams = append(stdoutStreams, f)
 		}
-		defer f.Close()
-		stdoutStreams = append(stdoutStreams, f)
-	}
 
-	if c.StdoutReader != nil {
-		r, w := io.Pipe()
-		stdoutStreams = append(stdoutStreams, w)
-		closeAfterWait = append(closeAfterWait, w)
+		if c.StdoutWriter != nil {
+			stdoutStreams = append(stdoutStreams, c.StdoutWriter)
+			e.inv.keepOpen(c.StdoutWriter)
+		}
 
-		handler := c.StdoutReader
-		servicers = append(servicers, func() {
-			err := handler(r)
-			if err != nil && err != io.EOF {
-				cancel()
-			}
-			drain(r)
-			servicerErrors <- err
-		})
-	}
+		if c.StdoutReader != nil {
+			stdoutStreams = append(stdoutStreams, e.readerServicer(c.StdoutReader))
+		}
+
+		if c.StdoutLineHandler != nil {
+			stdoutStreams = append(stdoutStreams,
+				e.readerServicer(c.lineReader(c.StdoutLineHandler)))
+		}
+
+		if c.StdoutJSONHandler != nil {
+			stdoutStreams = append(stdoutStreams,
+				e.readerServicer(jsonReader(c.StdoutJSONHandler)))
+		}
+
+		if !c.DiscardStdout && c.WriteStdoutToFile == "" {
+			stdoutStreams = append(stdoutStreams, &e.stdoutBuf)
+		}
 
-	var stdoutBuf strings.Builder
-	if !c.DiscardStdout && c.WriteStdoutToFile == "" {
-		stdoutStreams = append(stdoutStreams, &stdoutBuf)
+		if e.combined != nil {
+			stdoutStreams = append(stdoutStreams, e.combined.writer(StdoutStream))
+		}
 	}
 
 	if len(stdoutStreams) == 1 {
-		cmd.Stdout = stdoutStreams[0]
+		inv.Stdout = stdoutStreams[0]
 	} else if len(stdoutStreams) > 1 {
-		cmd.Stdout = io.MultiWriter(stdoutStreams...)
+		inv.Stdout = io.MultiWriter(stdoutStreams...)
 	}
 
 	// Configure stderr
 	var stderrStreams []io.Writer
 	if c.WriteStderrToFile != "" {
-		f, err := os.OpenFile(
-			c.WriteStderrToFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		f, err := e.openOutputFile("stderr", c.WriteStderrToFile, c.StderrFileMode)
 		if err != nil {
-			return "", "", fmt.Errorf(
-				"failed to open stderr file '%v': %w",
-				c.WriteStderrToFile, err)
+			return nil, err
 		}
-		defer f.Close()
 		stderrStreams = append(stderrStreams, f)
 	}
 
+	if c.StderrWriter != nil {
+		stderrStreams = append(stderrStreams, c.StderrWriter)
+		e.inv.keepOpen(c.StderrWriter)
+	}
+
 	if c.StderrReader != nil {
-		r, w := io.Pipe()
-		stderrStreams = append(stderrStreams, w)
-		closeAfterWait = append(closeAfterWait, w)
-
-		handler := c.StderrReader
-		servicers = append(servicers, func() {
-			err := handler(r)
-			if err != nil && err != io.EOF {
-				cancel()
-			}
-			drain(r)
-			servicerErrors <- err
-		})
+		stderrStreams = append(stderrStreams, e.readerServicer(c.StderrReader))
+	}
+
+	if c.StderrLineHandler != nil {
+		stderrStreams = append(stderrStreams,
+			e.readerServicer(c.lineReader(c.StderrLineHandler)))
 	}
 
-	var stderrBuf strings.Builder
 	if !c.DiscardStderr && c.WriteStderrToFile == "" {
-		stderrStreams = append(stderrStreams, &stderrBuf)
+		stderrStreams = append(stderrStreams, &e.stderrBuf)
+	}
+
+	if e.combined != nil {
+		stderrStreams = append(stderrStreams, e.combined.writer(StderrStream))
+	}
+
+	if c.StderrTailBytes > 0 || c.StderrTailLines > 0 {
+		var size = c.StderrTailBytes
+		if size <= 0 {
+			size = DefaultStderrTailBytes
+		}
+		e.stderrTail = newTailBuffer(size)
+		stderrStreams = append(stderrStreams, e.stderrTail)
 	}
 
 	if len(stderrStreams) == 1 {
-		cmd.Stderr = stderrStreams[0]
+		inv.Stderr = stderrStreams[0]
 	} else if len(stderrStreams) > 1 {
-		cmd.Stderr = io.MultiWriter(stderrStreams...)
+		inv.Stderr = io.MultiWriter(stderrStreams...)
 	}
 
-	// Configure stdin
+	// Track output activity for the idle watchdog
+	if c.IdleTimeout > 0 {
+		inv.Stdout = &activityWriter{e: e, w: inv.Stdout}
+		inv.Stderr = &activityWriter{e: e, w: inv.Stderr}
+	}
 
-	// Start the sub-process
-	c.configureCommand(cmd)
+	// Configure extra files
+	if err := e.setupExtraFiles(); err != nil {
+		return nil, err
+	}
 
-	if err := cmd.Start(); err != nil {
-		return "", "", fmt.Errorf(
-			"failed to start command '%v': %w",
-			c.Command, err)
+	// Configure stdin
+	if stdin != nil {
+		inv.Stdin = stdin
+	} else if c.StdinWriter != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+		}
+		e.closeAfterWait = append(e.closeAfterWait, r, w)
+		inv.Stdin = r
+
+		handler := c.StdinWriter
+		e.servicers = append(e.servicers, func() {
+			err := handler(w)
+			w.Close()
+			if isClosedPipe(err) {
+				// The child process exited or closed its stdin without
+				// reading all the input; this is not an error.
+				err = nil
+			}
+			if err != nil {
+				e.cancel()
+			}
+			e.servicerErrors <- err
+		})
+	} else if c.ReadStdinFromFile != "" {
+		f, err := os.Open(c.ReadStdinFromFile)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to open stdin file '%v': %w",
+				c.ReadStdinFromFile, err)
+		}
+		e.closeAfterWait = append(e.closeAfterWait, f)
+		inv.Stdin = f
+	} else if c.Stdin != "" {
+		inv.Stdin = strings.NewReader(c.Stdin)
 	}
 
-	if len(servicers) > 0 {
-		servicerErrors = make(chan error, len(servicerErrors))
-		for _, servicer := range servicers {
-			go servicer()
+	return e, nil
+}
+
+// readerServicer returns the write end of a pipe and registers a servicer that
+// passes the read end of that pipe to handler. If handler returns an error, the
+// command is aborted.
+func (e *execution) readerServicer(handler func(r io.Reader) error) io.Writer {
+	r, w := io.Pipe()
+	e.closeAfterWait = append(e.closeAfterWait, w)
+
+	e.servicers = append(e.servicers, func() {
+		err := handler(r)
+		if err != nil && err != io.EOF {
+			e.cancel()
 		}
+		drain(r)
+		e.servicerErrors <- err
+	})
+	return w
+}
+
+// start starts the sub-process through the runner of the command, and all the
+// associated servicers.
+func (e *execution) start() error {
+	var runner = e.c.Runner
+	if runner == nil {
+		runner = DefaultRunner
 	}
 
-	// err = cmd.Wait()
-	err = c.wait(cmd, ctx)
-	for _, c := range closeAfterWait {
-		c.Close()
+	e.startTime = time.Now()
+	atomic.StoreInt64(&e.lastActivity, e.startTime.UnixNano())
+	handle, err := runner.Start(&e.inv)
+	e.closeStartFiles(err == nil)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to start command '%v': %w",
+			e.c.Command, err)
+		e.close()
+		e.finalize(err)
+		e.cancel()
+		e.releaseOutputChunks()
+		e.onExit(nil, err)
+		return err
 	}
+	e.handle = handle
+	e.onStart(handle.Pid())
+	e.releaseOutputChunks()
+
+	e.servicerErrors = make(chan error, len(e.servicers))
+	for _, servicer := range e.servicers {
+		go servicer()
+	}
+	if e.c.IdleTimeout > 0 {
+		go e.watchIdle()
+	}
+	return nil
+}
+
+// wait waits for the sub-process and all the associated servicers to complete,
+// and returns the result of the execution and the first error encountered.
+func (e *execution) wait() (result *Result, err error) {
+	result = &Result{}
+	err = e.handle.Wait(result)
+	result.Duration = time.Since(e.startTime)
+	e.close()
 
 	// Wait for all servicers to complete and capture first error
 	var servicerError error
-	for range servicers {
-		if err := <-servicerErrors; err != nil && servicerError == nil {
+	for range e.servicers {
+		if err := <-e.servicerErrors; err != nil && servicerError == nil {
 			servicerError = err
 		}
 	}
@@ -257,15 +637,73 @@ func (c *Command) Run(ctx context.Context) (stdout, stderr string, err error) {
 	if servicerError != nil {
 		err = servicerError
 	}
-	if err == nil && ctx.Err() != nil {
-		err = ctx.Err()
+	if err == nil && e.ctx.Err() != nil {
+		err = e.ctx.Err()
 	}
-
-	stdout = stdoutBuf.String()
-	stderr = stderrBuf.String()
+	if _, ok := err.(exitCoder); ok && e.stderrTail != nil {
+		err = &ExitError{
+			Err:         err,
+			CommandLine: e.c.commandLine(),
+			StderrTail:  lastLines(e.stderrTail.String(), e.c.StderrTailLines),
+		}
+	}
+	if e.idleTimeout() && servicerError == nil {
+		err = ErrIdleTimeout.Errorf(
+			"no output from command '%v' for %v: %w",
+			e.c.Command, e.c.IdleTimeout, err)
+	}
+	if servicerError == nil {
+		if e.stdoutBuf.aborted {
+			err = ErrOutputLimitExceeded.Errorf(
+				"stdout of command '%v' exceeded %v bytes: %w",
+				e.c.Command, e.c.MaxStdoutBytes, err)
+		} else if e.stderrBuf.aborted {
+			err = ErrOutputLimitExceeded.Errorf(
+				"stderr of command '%v' exceeded %v bytes: %w",
+				e.c.Command, e.c.MaxStderrBytes, err)
+		}
+	}
+	err = e.finalize(err)
+	e.cancel()
+
+	result.Stdout = e.stdoutBuf.String()
+	result.Stderr = e.stderrBuf.String()
+	result.StdoutDroppedBytes = e.stdoutBuf.Dropped()
+	result.StderrDroppedBytes = e.stderrBuf.Dropped()
+	result.StdoutTruncated = result.StdoutDroppedBytes > 0
+	result.StderrTruncated = result.StderrDroppedBytes > 0
+	if e.combined != nil {
+		result.Output = e.combined.chunks
+	}
+	e.onExit(result, err)
 	return
 }
 
+// stop triggers the shutdown of the sub-process, with the specified grace
+// period instead of the one specified in the command.
+func (e *execution) stop(gracePeriod time.Duration) {
+	e.mutex.Lock()
+	e.sequence = e.c.singleStepSequence(gracePeriod)
+	e.mutex.Unlock()
+	e.cancel()
+}
+
+// shutdownSequence returns the shutdown sequence to apply to the sub-process.
+func (e *execution) shutdownSequence() []ShutdownStep {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.sequence
+}
+
+// close releases the resources associated with the execution that must be
+// closed once the sub-process has exited.
+func (e *execution) close() {
+	for _, c := range e.closeAfterWait {
+		c.Close()
+	}
+	e.closeAfterWait = nil
+}
+
 func drain(r io.Reader) {
 	var p = make([]byte, 4096)
 	for {
@@ -275,3 +713,13 @@ func drain(r io.Reader) {
 		}
 	}
 }
+
+// exitCoder is implemented by errors reporting a non-zero exit status, like
+// *exec.ExitError.
+type exitCoder interface {
+	ExitCode() int
+}
+
+func isClosedPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed)
+}
@@ -83,6 +83,108 @@ func TestCommandEnvOverride(t *testing.T) {
 // Directory and environment
 // ---------------------------------------------------------------------------
 
+// ---------------------------------------------------------------------------
+// Stdin
+
+func TestCommandStdin(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "cat",
+		Stdin:   "Hello World\n",
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello World\n")
+}
+
+func TestCommandStdinFromFile(t *testing.T) {
+	var tmp = tempDir(t)
+	var stdinFile = fileutils.Join(tmp, "stdin.txt")
+	ioutil.WriteFile(stdinFile, []byte("Hello from file\n"), 0666)
+
+	var cmd = popen.Command{
+		Command:           "cat",
+		Stdin:             "Hello World\n", // Ignored
+		ReadStdinFromFile: stdinFile,
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello from file\n")
+}
+
+func TestCommandStdinFromInvalidPathFile(t *testing.T) {
+	var cmd = popen.Command{
+		Command:           "cat",
+		ReadStdinFromFile: "__invalid_path__/stdin.txt",
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNotNil()
+	verify.That(t, os.IsNotExist(errors.Unwrap(err))).IsTrue()
+}
+
+func TestCommandStdinWriter(t *testing.T) {
+	var cmd = popen.Command{
+		Command:           "cat",
+		Stdin:             "Hello World\n",              // Ignored
+		ReadStdinFromFile: "__invalid_path__/stdin.txt", // Ignored
+		StdinWriter: func(w io.Writer) error {
+			for i := 0; i < 10; i++ {
+				if _, err := io.WriteString(w, "Hello World\n"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq(strings.Repeat("Hello World\n", 10))
+}
+
+func TestCommandStdinWriterErrorAbortsCommand(t *testing.T) {
+	var expectedError = errors.New("stdin writer error")
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"sleep 10; cat",
+		},
+		StdinWriter: func(w io.Writer) error {
+			return expectedError
+		},
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(expectedError)
+}
+
+func TestCommandStdinWriterIgnoresUnreadInput(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "head",
+		Arguments: []string{
+			"-n1",
+		},
+		StdinWriter: func(w io.Writer) error {
+			for i := 0; i < 100000; i++ {
+				if _, err := io.WriteString(w, "Hello World\n"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello World\n")
+}
+
+// Stdin
+// ---------------------------------------------------------------------------
+
 // ---------------------------------------------------------------------------
 // Stdout
 
@@ -126,6 +228,109 @@ func TestCommandStdoutReaderErrorAbortsCommand(t *testing.T) {
 	verify.That(t, err).IsError(expectedError)
 }
 
+func TestCommandStdoutLineHandler(t *testing.T) {
+	var lines []string
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo Hello; echo; printf 'World\\r\\n'; printf Bye",
+		},
+		StdoutLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello\n\nWorld\r\nBye")
+	verify.That(t, lines).Eq([]string{"Hello", "", "World", "Bye"})
+}
+
+func TestCommandStdoutLineHandlerOptions(t *testing.T) {
+	var lines []string
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo 0123456789012345678901234; printf Bye",
+		},
+		StdoutLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+		MaxLineLength:           20,
+		DiscardUnterminatedLine: true,
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, lines).Eq([]string{"01234567890123456789", "01234"})
+}
+
+func TestCommandStdoutLineHandlerMaxLineLength(t *testing.T) {
+	var lines []string
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo 0123456789012345; printf 'short\\r\\n'; echo; printf 01234567",
+		},
+		StdoutLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+		MaxLineLength: 4,
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, lines).Eq([]string{
+		"0123", "4567", "8901", "2345",
+		"shor", "t",
+		"",
+		"0123", "4567",
+	})
+}
+
+func TestCommandStdoutLineHandlerDiscardUnterminatedLine(t *testing.T) {
+	var lines []string
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo Hello; printf Bye",
+		},
+		StdoutLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+		DiscardUnterminatedLine: true,
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, lines).Eq([]string{"Hello"})
+}
+
+func TestCommandStdoutLineHandlerErrorAbortsCommand(t *testing.T) {
+	var expectedError = errors.New("stdout line handler error")
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo Hello;sleep 10;echo Bye",
+		},
+		StdoutLineHandler: func(line string) error {
+			return expectedError
+		},
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(expectedError)
+}
+
 func TestCommandStdoutToFile(t *testing.T) {
 
 	var tmp = tempDir(t)
@@ -220,6 +425,28 @@ func TestCommandStderrReaderErrorAbortsCommand(t *testing.T) {
 	verify.That(t, err).IsError(expectedError)
 }
 
+func TestCommandStderrLineHandler(t *testing.T) {
+	var lines []string
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"for i in {1..10}; do echo Hello World $i 1>&2; done",
+		},
+		StderrLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+		DiscardStderr: true,
+	}
+
+	_, stderr, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stderr).Eq("")
+	verify.That(t, lines).Length().Eq(10)
+	verify.That(t, lines[9]).Eq("Hello World 10")
+}
+
 func TestCommandStderrToFile(t *testing.T) {
 
 	var tmp = tempDir(t)
@@ -4,19 +4,47 @@
 package popen
 
 import (
-	"context"
+	"fmt"
+	"os"
 	"os/exec"
+	"runtime"
 	"syscall"
 	"time"
 )
 
 func (c *Command) configureCommand(cmd *exec.Cmd) {
-	if !c.NoProcessGroup {
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var attr = &syscall.SysProcAttr{
+		Setpgid: !c.NoProcessGroup,
 	}
+	if c.Credential != nil {
+		attr.Credential = &syscall.Credential{
+			Uid:         c.Credential.Uid,
+			Gid:         c.Credential.Gid,
+			Groups:      c.Credential.Groups,
+			NoSetGroups: c.Credential.NoSetGroups,
+		}
+	}
+	c.configurePlatform(attr)
+	cmd.SysProcAttr = attr
+}
+
+// configureProcess applies the process attributes that can only be set once
+// the child process is started. They are applied concurrently with the program
+// of the child process, which runs without them for a short time.
+func (c *Command) configureProcess(pid int) error {
+	if err := setRlimits(pid, c.Rlimits); err != nil {
+		return err
+	}
+	if c.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, c.Nice); err != nil {
+			return fmt.Errorf("failed to set nice value %v: %w", c.Nice, err)
+		}
+	}
+	return nil
 }
 
-func (c *Command) wait(cmd *exec.Cmd, ctx context.Context) error {
+func (h *execHandle) wait(result *Result) error {
+	var cmd = h.cmd
 	var waitError error
 	var waitDone = make(chan struct{})
 
@@ -28,27 +56,33 @@ func (c *Command) wait(cmd *exec.Cmd, ctx context.Context) error {
 	select {
 	case <-waitDone:
 		return waitError
-	case <-ctx.Done():
+	case <-h.inv.Context.Done():
 	}
+	result.Shutdown = true
 
-	if c.ShutdownGracePeriod != 0 {
-		if c.ShutdownSignal == 0 {
-			c.ShutdownSignal = syscall.SIGINT
-		}
-		c.kill(cmd, c.ShutdownSignal)
+	for i, step := range h.inv.ShutdownSequence() {
+		result.ShutdownStep = i + 1
+		result.ShutdownSignal = step.Signal
+		h.inv.NotifySignal(step.Signal)
+		h.inv.Command.kill(cmd, step.Signal)
 
+		var timer = time.NewTimer(step.Wait)
 		select {
 		case <-waitDone:
+			timer.Stop()
 			return waitError
-		case <-time.After(c.ShutdownGracePeriod):
+		case <-timer.C:
 		}
 	}
+	result.ShutdownStep++
+	result.ShutdownSignal = syscall.SIGKILL
+	h.inv.NotifySignal(syscall.SIGKILL)
 
 	cmd.Process.Kill()
 
-	// Kill process after potential grace period; ignore error -- process
+	// Kill process after potential shutdown steps; ignore error -- process
 	// already exited
-	c.kill(cmd, syscall.SIGKILL)
+	h.inv.Command.kill(cmd, syscall.SIGKILL)
 
 	<-waitDone
 	return waitError
@@ -60,3 +94,25 @@ func (c *Command) kill(cmd *exec.Cmd, signal syscall.Signal) error {
 	}
 	return syscall.Kill(-cmd.Process.Pid, signal)
 }
+
+func (r *Result) setProcessState(ps *os.ProcessState) {
+	if ps == nil {
+		r.ExitCode = -1
+		return
+	}
+	r.ExitCode = ps.ExitCode()
+	r.UserTime = ps.UserTime()
+	r.SystemTime = ps.SystemTime()
+
+	if status, ok := ps.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		r.Signal = status.Signal()
+	}
+	if usage, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		// ru_maxrss is reported in bytes on darwin, and in kilobytes on other
+		// unix platforms
+		r.MaxRSS = int64(usage.Maxrss)
+		if runtime.GOOS != "darwin" {
+			r.MaxRSS *= 1024
+		}
+	}
+}
@@ -5,6 +5,7 @@ package popen_test
 
 import (
 	"context"
+	"errors"
 	"syscall"
 	"testing"
 	"time"
@@ -52,6 +53,26 @@ func TestCommandTimeoutSigint(t *testing.T) {
 	verify.That(t, err).ToString().Eq("signal: terminated")
 }
 
+func TestCommandTimeoutResult(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "sleep",
+		Arguments: []string{
+			"3",
+		},
+		ShutdownGracePeriod: 200 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := cmd.RunResult(ctx)
+
+	verify.That(t, err).ToString().Eq("signal: interrupt")
+	verify.That(t, result.ExitCode).Eq(-1)
+	verify.That(t, result.Signal).Eq(syscall.SIGINT)
+	verify.That(t, result.Shutdown).IsTrue()
+	verify.That(t, result.MaxRSS).Gt(int64(0))
+}
+
 func TestCommandShutdownGracePeriod(t *testing.T) {
 	// Pre-built test child process to avoid long timeouts
 	var build = popen.Command{
@@ -100,3 +121,150 @@ func TestCommandShutdownGracePeriod(t *testing.T) {
 
 // ShutdownGracePeriod -- unix only
 // ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// ShutdownSequence -- unix only
+
+func TestCommandShutdownSequence(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "trap '' INT; sleep 3"},
+		ShutdownSequence: []popen.ShutdownStep{
+			{Signal: syscall.SIGINT, Wait: 200 * time.Millisecond},
+			{Signal: syscall.SIGTERM, Wait: 2 * time.Second},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	result, err := cmd.RunResult(ctx)
+
+	verify.That(t, err).ToString().Eq("signal: terminated")
+	verify.That(t, result.Shutdown).IsTrue()
+	verify.That(t, result.ShutdownStep).Eq(2)
+	verify.That(t, result.ShutdownSignal).Eq(syscall.SIGTERM)
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
+
+func TestCommandShutdownSequenceKill(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "trap '' INT TERM; sleep 3"},
+		ShutdownSequence: []popen.ShutdownStep{
+			{Signal: syscall.SIGINT, Wait: 100 * time.Millisecond},
+			{Signal: syscall.SIGTERM, Wait: 100 * time.Millisecond},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := cmd.RunResult(ctx)
+
+	verify.That(t, err).ToString().Eq("signal: killed")
+	verify.That(t, result.ShutdownStep).Eq(3)
+	verify.That(t, result.ShutdownSignal).Eq(syscall.SIGKILL)
+}
+
+func TestCommandShutdownGracePeriodShorthand(t *testing.T) {
+	var cmd = popen.Command{
+		Command:             "sleep",
+		Arguments:           []string{"3"},
+		ShutdownGracePeriod: 200 * time.Millisecond,
+		ShutdownSignal:      syscall.SIGTERM,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := cmd.RunResult(ctx)
+
+	verify.That(t, err).ToString().Eq("signal: terminated")
+	verify.That(t, result.ShutdownStep).Eq(1)
+	verify.That(t, result.ShutdownSignal).Eq(syscall.SIGTERM)
+}
+
+// ShutdownSequence -- unix only
+// ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// IdleTimeout -- unix only
+
+func TestCommandIdleTimeout(t *testing.T) {
+	var cmd = popen.Command{
+		Command:             "bash",
+		Arguments:           []string{"-c", "echo foo; sleep 3"},
+		IdleTimeout:         200 * time.Millisecond,
+		ShutdownGracePeriod: 200 * time.Millisecond,
+	}
+
+	var start = time.Now()
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(popen.ErrIdleTimeout)
+	verify.That(t, err).ToString().Contains("no output from command 'bash' for 200ms")
+	verify.That(t, result.Stdout).Eq("foo\n")
+	verify.That(t, result.Shutdown).IsTrue()
+	verify.That(t, result.Signal).Eq(syscall.SIGINT)
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
+
+func TestCommandIdleTimeoutResetByOutput(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{"-c",
+			"for i in 1 2 3 4 5; do echo $i >&2; sleep 0.1; done"},
+		IdleTimeout: 500 * time.Millisecond,
+	}
+
+	_, stderr, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stderr).Eq("1\n2\n3\n4\n5\n")
+}
+
+func TestCommandIdleTimeoutContextDone(t *testing.T) {
+	var cmd = popen.Command{
+		Command:     "sleep",
+		Arguments:   []string{"3"},
+		IdleTimeout: 2 * time.Second,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err := cmd.Run(ctx)
+	verify.That(t, errors.Is(err, popen.ErrIdleTimeout)).IsFalse()
+	verify.That(t, err).ToString().Eq("signal: killed")
+}
+
+// IdleTimeout -- unix only
+// ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// Hooks -- unix only
+
+func TestCommandHooksOnSignal(t *testing.T) {
+	var signals []syscall.Signal
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "trap '' INT TERM; sleep 3"},
+		ShutdownSequence: []popen.ShutdownStep{
+			{Signal: syscall.SIGINT, Wait: 100 * time.Millisecond},
+			{Signal: syscall.SIGTERM, Wait: 100 * time.Millisecond},
+		},
+		Hooks: &popen.Hooks{
+			OnSignal: func(inv *popen.Invocation, signal syscall.Signal) {
+				signals = append(signals, signal)
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := cmd.RunResult(ctx)
+
+	verify.That(t, err).ToString().Eq("signal: killed")
+	verify.That(t, signals).Eq([]syscall.Signal{
+		syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL,
+	})
+}
+
+// Hooks -- unix only
+// ---------------------------------------------------------------------------
@@ -4,15 +4,22 @@
 package popen
 
 import (
-	"context"
+	"os"
 	"os/exec"
+	"syscall"
 )
 
 func (c *Command) configureCommand(cmd *exec.Cmd) {
 	// NoProcessGroup options is not supported on windows
 }
 
-func (c *Command) wait(cmd *exec.Cmd, ctx context.Context) error {
+func (c *Command) configureProcess(pid int) error {
+	// Process attributes are not supported on windows
+	return nil
+}
+
+func (h *execHandle) wait(result *Result) error {
+	var cmd = h.cmd
 	var waitError error
 	var waitDone = make(chan struct{})
 
@@ -24,11 +31,29 @@ func (c *Command) wait(cmd *exec.Cmd, ctx context.Context) error {
 	select {
 	case <-waitDone:
 		return waitError
-	case <-ctx.Done():
+	case <-h.inv.Context.Done():
 	}
+	result.Shutdown = true
+	result.ShutdownStep = 1
+	result.ShutdownSignal = syscall.SIGKILL
+	h.inv.NotifySignal(syscall.SIGKILL)
 
 	cmd.Process.Kill()
 
 	<-waitDone
 	return waitError
 }
+
+func (c *Command) kill(cmd *exec.Cmd, signal syscall.Signal) error {
+	return cmd.Process.Signal(signal)
+}
+
+func (r *Result) setProcessState(ps *os.ProcessState) {
+	if ps == nil {
+		r.ExitCode = -1
+		return
+	}
+	r.ExitCode = ps.ExitCode()
+	r.UserTime = ps.UserTime()
+	r.SystemTime = ps.SystemTime()
+}
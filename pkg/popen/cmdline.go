@@ -0,0 +1,260 @@
+package popen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParseCommandLine splits a command line into a command and its arguments,
+// following the quoting rules of POSIX shells but without invoking a shell.
+// Single quotes preserve the literal value of all enclosed characters; double
+// quotes preserve the literal value of all enclosed characters except for `$`
+// and `\`, which escapes only `$`, `"`, `\` and newline; outside of quotes, `\`
+// preserves the literal value of the next character. Leading `NAME=value`
+// assignments are returned in `Env`. A `#` at the beginning of a word starts a
+// comment that extends to the end of the line.
+//
+// If getenv is not nil, `$NAME` and `${NAME}` occurrences outside of single
+// quotes are replaced with the value returned by getenv. As in a shell, an
+// unquoted word that expands to an empty string is dropped, but unlike in a
+// shell, the expanded values are never split into multiple arguments.
+// Unquoted shell operators like `|`, `&`, `;`, `<`, `>`, `(`, `)` or
+// backquotes are not supported and cause an error to be returned.
+//
+// Unlike in a shell, tilde expansion and pathname expansion are not performed:
+// a leading `~` and the glob characters `*`, `?` and `[` are passed through
+// literally, so that `ls *.go` results in a single `*.go` argument. Use
+// `dir.Glob()` to expand patterns explicitly if needed.
+func ParseCommandLine(cmdline string, getenv func(name string) string) (*Command, error) {
+	words, err := splitCommandLine(cmdline, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &Command{}
+	for _, w := range words {
+		if c.Command == "" && w.assignment {
+			c.Env = append(c.Env, w.value)
+		} else if c.Command == "" {
+			c.Command = w.value
+		} else {
+			c.Arguments = append(c.Arguments, w.value)
+		}
+	}
+	if c.Command == "" {
+		return nil, fmt.Errorf("failed to parse command line '%v': missing command", cmdline)
+	}
+	return c, nil
+}
+
+// String returns a representation of the command as a properly quoted shell
+// command line that can be copied and pasted into a POSIX shell to run the
+// same command, including changing directory and setting up environment
+// variables if needed. The environment is rendered as the changes made to the
+// environment of the current process, as returned by `EnvChanges()`.
+func (c *Command) String() string {
+	var b strings.Builder
+	if c.Directory != "" {
+		b.WriteString("cd ")
+		b.WriteString(QuoteArgument(c.Directory))
+		b.WriteString(" && ")
+	}
+	var set, unset = c.EnvChanges()
+	if c.OverwriteEnv {
+		b.WriteString("env -i ")
+	} else if len(unset) > 0 {
+		b.WriteString("env ")
+		for _, name := range unset {
+			b.WriteString("-u ")
+			b.WriteString(QuoteArgument(name))
+			b.WriteString(" ")
+		}
+	}
+	for _, env := range set {
+		var parts = strings.SplitN(env, "=", 2)
+		b.WriteString(parts[0])
+		if len(parts) > 1 {
+			b.WriteString("=")
+			b.WriteString(QuoteArgument(parts[1]))
+		}
+		b.WriteString(" ")
+	}
+	b.WriteString(c.commandLine())
+	return b.String()
+}
+
+// commandLine returns the properly quoted command and arguments, without any
+// directory or environment prefix.
+func (c *Command) commandLine() string {
+	var words = make([]string, 0, len(c.Arguments)+1)
+	words = append(words, QuoteArgument(c.Command))
+	for _, arg := range c.Arguments {
+		words = append(words, QuoteArgument(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// QuoteArgument returns a quoted representation of s that is interpreted by
+// POSIX shells as the literal value of s. Values that contain no special
+// characters are returned unquoted.
+func QuoteArgument(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !unsafeArgumentChars.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+var unsafeArgumentChars = regexp.MustCompile(`[^A-Za-z0-9_@%+=:,./-]`)
+var assignmentPrefix = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+type commandLineWord struct {
+	value      string
+	assignment bool
+}
+
+func splitCommandLine(cmdline string, getenv func(name string) string) (words []commandLineWord, err error) {
+	var word strings.Builder
+	var inWord, quoted bool
+	var start int
+
+	// Like in a shell, an unquoted word that expands to nothing is dropped
+	var endWord = func(end int) {
+		if word.Len() > 0 || quoted {
+			words = append(words, commandLineWord{
+				value:      word.String(),
+				assignment: assignmentPrefix.MatchString(cmdline[start:end]),
+			})
+		}
+		word.Reset()
+		inWord, quoted = false, false
+	}
+
+	var fail = func(format string, args ...interface{}) ([]commandLineWord, error) {
+		return nil, fmt.Errorf("failed to parse command line '%v': %v",
+			cmdline, fmt.Sprintf(format, args...))
+	}
+
+	var expand = func(i int) (int, error) {
+		var s = cmdline[i+1:]
+		if strings.HasPrefix(s, "{") {
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return 0, fmt.Errorf("unterminated variable expansion at offset %v", i)
+			}
+			var name = s[1:end]
+			if variableName.FindString(name) != name {
+				return 0, fmt.Errorf("invalid variable name '%v'", name)
+			}
+			word.WriteString(getenv(name))
+			return i + end + 1, nil
+		}
+		if strings.HasPrefix(s, "(") {
+			return 0, fmt.Errorf("unsupported command substitution at offset %v", i)
+		}
+		var name = variableName.FindString(s)
+		if name == "" {
+			word.WriteByte('$')
+			return i, nil
+		}
+		word.WriteString(getenv(name))
+		return i + len(name), nil
+	}
+
+	for i := 0; i < len(cmdline); i++ {
+		var ch = cmdline[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				endWord(i)
+			}
+			continue
+
+		case ch == '#' && !inWord:
+			// Comment, up to the end of the line
+			if end := strings.IndexByte(cmdline[i:], '\n'); end >= 0 {
+				i += end - 1
+			} else {
+				i = len(cmdline)
+			}
+			continue
+
+		case ch == '\\' && i+1 < len(cmdline) && cmdline[i+1] == '\n':
+			// Line continuation
+			i++
+			continue
+
+		case strings.IndexByte("|&;<>()`", ch) >= 0:
+			return fail("unsupported shell operator '%c' at offset %v", ch, i)
+		}
+
+		if !inWord {
+			inWord = true
+			start = i
+		}
+
+		switch ch {
+		case '\\':
+			quoted = true
+			i++
+			if i >= len(cmdline) {
+				return fail("trailing backslash")
+			}
+			word.WriteByte(cmdline[i])
+
+		case '\'':
+			quoted = true
+			end := strings.IndexByte(cmdline[i+1:], '\'')
+			if end < 0 {
+				return fail("unterminated single quote at offset %v", i)
+			}
+			word.WriteString(cmdline[i+1 : i+1+end])
+			i += end + 1
+
+		case '"':
+			quoted = true
+			var j = i + 1
+			for ; j < len(cmdline) && cmdline[j] != '"'; j++ {
+				switch {
+				case cmdline[j] == '\\' && j+1 < len(cmdline) &&
+					strings.IndexByte("$`\"\\\n", cmdline[j+1]) >= 0:
+					j++
+					if cmdline[j] != '\n' {
+						word.WriteByte(cmdline[j])
+					}
+				case cmdline[j] == '$' && getenv != nil:
+					if j, err = expand(j); err != nil {
+						return fail("%v", err)
+					}
+				case cmdline[j] == '`':
+					return fail("unsupported command substitution at offset %v", j)
+				default:
+					word.WriteByte(cmdline[j])
+				}
+			}
+			if j >= len(cmdline) {
+				return fail("unterminated double quote at offset %v", i)
+			}
+			i = j
+
+		case '$':
+			if getenv == nil {
+				word.WriteByte(ch)
+			} else if i, err = expand(i); err != nil {
+				return fail("%v", err)
+			}
+
+		default:
+			word.WriteByte(ch)
+		}
+	}
+
+	if inWord {
+		endWord(len(cmdline))
+	}
+	return words, nil
+}
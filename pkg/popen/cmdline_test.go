@@ -0,0 +1,146 @@
+package popen_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+// ---------------------------------------------------------------------------
+// ParseCommandLine
+
+var parseCommandLineTestCases = []struct {
+	cmdline string
+	command string
+	args    []string
+	env     []string
+}{
+	{cmdline: "ls", command: "ls"},
+	{cmdline: "  ls  -l   -a ", command: "ls", args: []string{"-l", "-a"}},
+	{cmdline: `echo 'a b' "c d"`, command: "echo", args: []string{"a b", "c d"}},
+	{cmdline: `echo '' ""`, command: "echo", args: []string{"", ""}},
+	{cmdline: `echo a\ b \'c\'`, command: "echo", args: []string{"a b", "'c'"}},
+	{cmdline: `echo 'a\b' "a\b" "\"\$\\"`, command: "echo", args: []string{`a\b`, `a\b`, `"$\`}},
+	{cmdline: `echo a'b'"c"d`, command: "echo", args: []string{"abcd"}},
+	{cmdline: "echo a \\\n b", command: "echo", args: []string{"a", "b"}},
+	{cmdline: `echo $HOME '$HOME'`, command: "echo", args: []string{"$HOME", "$HOME"}},
+	{cmdline: `jq '.items | length'`, command: "jq", args: []string{".items | length"}},
+	{
+		cmdline: `FOO=bar BAR='a b' env X=y`,
+		command: "env", args: []string{"X=y"},
+		env: []string{"FOO=bar", "BAR=a b"},
+	},
+	{cmdline: `'FOO=bar' ls`, command: "FOO=bar", args: []string{"ls"}},
+	{cmdline: "ls -l # comment", command: "ls", args: []string{"-l"}},
+	{cmdline: "ls *.go ~/src file?.[ch]", command: "ls", args: []string{"*.go", "~/src", "file?.[ch]"}},
+	{cmdline: "# comment\nls a#b '#c' \\#d", command: "ls", args: []string{"a#b", "#c", "#d"}},
+}
+
+func TestParseCommandLine(t *testing.T) {
+	for _, tc := range parseCommandLineTestCases {
+		t.Run(tc.cmdline, func(t *testing.T) {
+			cmd, err := popen.ParseCommandLine(tc.cmdline, nil)
+			verify.That(t, err).IsNil()
+			verify.That(t, cmd.Command).Eq(tc.command)
+			verify.That(t, cmd.Arguments).Eq(tc.args)
+			verify.That(t, cmd.Env).Eq(tc.env)
+		})
+	}
+}
+
+func TestParseCommandLineExpansion(t *testing.T) {
+	var getenv = func(name string) string {
+		return map[string]string{
+			"FOO": "foo value",
+			"BAR": "bar",
+		}[name]
+	}
+
+	cmd, err := popen.ParseCommandLine(
+		`echo $FOO "${BAR}baz" '$FOO' \$FOO $UNDEFINED "$UNDEFINED" $ "$"`, getenv)
+	verify.That(t, err).IsNil()
+	verify.That(t, cmd.Command).Eq("echo")
+	verify.That(t, cmd.Arguments).Eq([]string{
+		"foo value", "barbaz", "$FOO", "$FOO", "", "$", "$",
+	})
+}
+
+func TestParseCommandLineErrors(t *testing.T) {
+	var getenv = func(name string) string { return "" }
+	var cmdlines = []string{
+		"",
+		"   ",
+		"FOO=bar",
+		`echo 'abc`,
+		`echo "abc`,
+		`echo abc\`,
+		`ls | grep foo`,
+		`ls; rm foo`,
+		`ls > out.txt`,
+		"echo `ls`",
+		`echo $(ls)`,
+		`echo "$(ls)"`,
+		`echo ${FOO`,
+		`echo ${FOO-bar}`,
+	}
+
+	for _, cmdline := range cmdlines {
+		t.Run(cmdline, func(t *testing.T) {
+			cmd, err := popen.ParseCommandLine(cmdline, getenv)
+			verify.That(t, cmd).IsNil()
+			verify.That(t, err).IsNotNil()
+		})
+	}
+}
+
+// ParseCommandLine
+// ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// Command.String()
+
+func TestCommandString(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "echo",
+		Arguments: []string{"Hello World", "it's", "", "a-b_c/d.e"},
+	}
+	verify.That(t, cmd.String()).Eq(`echo 'Hello World' 'it'\''s' '' a-b_c/d.e`)
+}
+
+func TestCommandStringWithDirectoryAndEnv(t *testing.T) {
+	var cmd = popen.Command{
+		Directory:    "/tmp/my dir",
+		Command:      "env",
+		Env:          []string{"FOO=bar baz", "EMPTY="},
+		OverwriteEnv: true,
+	}
+	verify.That(t, cmd.String()).Eq(
+		`cd '/tmp/my dir' && env -i FOO='bar baz' EMPTY='' env`)
+}
+
+func TestCommandStringRoundTrip(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			`echo "$FOO" 'quoted' \ && exit 0`,
+		},
+		Env: []string{"FOO=Hello World"},
+	}
+
+	parsed, err := popen.ParseCommandLine(cmd.String(), nil)
+	verify.That(t, err).IsNil()
+	verify.That(t, parsed.Command).Eq(cmd.Command)
+	verify.That(t, parsed.Arguments).Eq(cmd.Arguments)
+	verify.That(t, parsed.Env).Eq(cmd.Env)
+
+	stdout, _, err := parsed.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello World quoted  \n")
+}
+
+// Command.String()
+// ---------------------------------------------------------------------------
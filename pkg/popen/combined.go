@@ -0,0 +1,226 @@
+package popen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputStream identifies an output stream of a command.
+type OutputStream int
+
+const (
+	// StdoutStream is the stdout stream of a command.
+	StdoutStream OutputStream = iota + 1
+
+	// StderrStream is the stderr stream of a command.
+	StderrStream
+)
+
+func (s OutputStream) String() string {
+	switch s {
+	case StdoutStream:
+		return "stdout"
+	case StderrStream:
+		return "stderr"
+	}
+	return "unknown"
+}
+
+// parseOutputStream returns the OutputStream named s.
+func parseOutputStream(s string) (OutputStream, error) {
+	switch s {
+	case "stdout":
+		return StdoutStream, nil
+	case "stderr":
+		return StderrStream, nil
+	}
+	return 0, fmt.Errorf("invalid stream '%v'", s)
+}
+
+// OutputChunk is a chunk of output written by a command on one of its output
+// streams, as recorded in combined output mode.
+type OutputChunk struct {
+	// Stream is the stream the chunk was written to.
+	Stream OutputStream
+
+	// Time is the time at which the chunk was received.
+	Time time.Time
+
+	// Data is the content of the chunk.
+	Data string
+}
+
+// CombinedOutput returns the combined content of stdout and stderr, in the
+// order it was received, as recorded with the `CombinedOutput` option.
+func (r *Result) CombinedOutput() string {
+	var b strings.Builder
+	for _, chunk := range r.Output {
+		b.WriteString(chunk.Data)
+	}
+	return b.String()
+}
+
+// combinedOutput records the chunks written to the stdout and stderr streams
+// of a command, in order, into memory and / or into an output file, and passes
+// them to onChunk. If hold is set, chunks are queued until `release()` is
+// called before being passed to onChunk.
+type combinedOutput struct {
+	mutex   sync.Mutex
+	record  bool
+	chunks  []OutputChunk
+	w       io.Writer
+	onChunk func(chunk OutputChunk)
+	hold    bool
+	held    []OutputChunk
+}
+
+// release passes any chunk held so far to onChunk, and stops holding further
+// chunks.
+func (o *combinedOutput) release() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for _, chunk := range o.held {
+		o.onChunk(chunk)
+	}
+	o.held = nil
+	o.hold = false
+}
+
+// writer returns an io.Writer that records all chunks written into it as
+// output of the specified stream.
+func (o *combinedOutput) writer(stream OutputStream) io.Writer {
+	return &combinedWriter{o: o, stream: stream}
+}
+
+type combinedWriter struct {
+	o      *combinedOutput
+	stream OutputStream
+}
+
+func (w *combinedWriter) Write(p []byte) (n int, err error) {
+	var chunk = OutputChunk{Stream: w.stream, Time: time.Now(), Data: string(p)}
+
+	w.o.mutex.Lock()
+	defer w.o.mutex.Unlock()
+	if w.o.record {
+		w.o.chunks = append(w.o.chunks, chunk)
+	}
+	if w.o.hold {
+		w.o.held = append(w.o.held, chunk)
+	} else if w.o.onChunk != nil {
+		w.o.onChunk(chunk)
+	}
+	if w.o.w != nil {
+		if err = writeOutputChunk(w.o.w, chunk); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// WriteCombinedOutput writes chunks of output into w, in the format used by
+// `WriteCombinedOutputToFile`. Each chunk is written as a header line in the
+// form `<time> <stream> <length>`, where time is in RFC 3339 format with
+// nanoseconds, stream is either `stdout` or `stderr`, and length is the size of
+// the data in bytes, followed by the data itself and a newline.
+func WriteCombinedOutput(w io.Writer, chunks []OutputChunk) error {
+	for _, chunk := range chunks {
+		if err := writeOutputChunk(w, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeOutputChunk(w io.Writer, chunk OutputChunk) error {
+	_, err := fmt.Fprintf(w, "%v %v %v\n%v\n",
+		chunk.Time.Format(time.RFC3339Nano), chunk.Stream, len(chunk.Data),
+		chunk.Data)
+	return err
+}
+
+// ReadCombinedOutput reads chunks of output from r, in the format written by
+// `WriteCombinedOutput()`.
+func ReadCombinedOutput(r io.Reader) ([]OutputChunk, error) {
+	var chunks []OutputChunk
+	var br = bufio.NewReader(r)
+	for {
+		header, err := br.ReadString('\n')
+		if err == io.EOF && header == "" {
+			return chunks, nil
+		}
+		if err != nil {
+			return chunks, fmt.Errorf(
+				"failed to read combined output chunk %v: %w",
+				len(chunks)+1, err)
+		}
+
+		chunk, err := readOutputChunk(br, strings.TrimSuffix(header, "\n"))
+		if err != nil {
+			return chunks, fmt.Errorf(
+				"failed to read combined output chunk %v: %w",
+				len(chunks)+1, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func readOutputChunk(r *bufio.Reader, header string) (chunk OutputChunk, err error) {
+	var fields = strings.Fields(header)
+	if len(fields) != 3 {
+		return chunk, fmt.Errorf("invalid header '%v'", header)
+	}
+	if chunk.Time, err = time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		return chunk, err
+	}
+	if chunk.Stream, err = parseOutputStream(fields[1]); err != nil {
+		return chunk, err
+	}
+	length, err := strconv.Atoi(fields[2])
+	if err != nil || length < 0 {
+		return chunk, fmt.Errorf("invalid length '%v'", fields[2])
+	}
+
+	var data = make([]byte, length+1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return chunk, fmt.Errorf("truncated data: %w", io.ErrUnexpectedEOF)
+	}
+	if data[length] != '\n' {
+		return chunk, fmt.Errorf("missing newline after data")
+	}
+	chunk.Data = string(data[:length])
+	return chunk, nil
+}
+
+// ReplayCombinedOutput writes chunks of output to stdout or stderr according
+// to their stream, reproducing the original timing between chunks, until all
+// chunks are written or the context becomes done. If either writer is nil, the
+// corresponding chunks are skipped.
+func ReplayCombinedOutput(ctx context.Context, chunks []OutputChunk, stdout, stderr io.Writer) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for i, chunk := range chunks {
+		if i > 0 {
+			if err := sleep(ctx, chunk.Time.Sub(chunks[i-1].Time)); err != nil {
+				return err
+			}
+		}
+		var w = stdout
+		if chunk.Stream == StderrStream {
+			w = stderr
+		}
+		if w != nil {
+			if _, err := io.WriteString(w, chunk.Data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
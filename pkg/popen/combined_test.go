@@ -0,0 +1,124 @@
+package popen_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+// ---------------------------------------------------------------------------
+// CombinedOutput
+
+func TestCommandCombinedOutput(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{"-c",
+			"echo one; sleep 0.05; echo two >&2; sleep 0.05; echo three"},
+		CombinedOutput: true,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, result.Stdout).Eq("one\nthree\n")
+	verify.That(t, result.Stderr).Eq("two\n")
+	verify.That(t, result.CombinedOutput()).Eq("one\ntwo\nthree\n")
+
+	var streams []string
+	for _, chunk := range result.Output {
+		streams = append(streams, chunk.Stream.String())
+	}
+	verify.That(t, streams).Eq([]string{"stdout", "stderr", "stdout"})
+	verify.That(t, result.Output[2].Time.After(result.Output[0].Time)).IsTrue()
+}
+
+func TestCommandWriteCombinedOutputToFile(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "output.log")
+	var cmd = popen.Command{
+		Command:                   "bash",
+		Arguments:                 []string{"-c", "echo one; sleep 0.05; echo two >&2"},
+		WriteCombinedOutputToFile: filename,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, result.Output).IsEmpty()
+
+	f, err := os.Open(filename)
+	verify.That(t, err).IsError(nil)
+	defer f.Close()
+	chunks, err := popen.ReadCombinedOutput(f)
+	verify.That(t, err).IsError(nil)
+	verify.That(t, chunks).Length().Eq(2)
+	verify.That(t, chunks[0].Stream).Eq(popen.StdoutStream)
+	verify.That(t, chunks[0].Data).Eq("one\n")
+	verify.That(t, chunks[1].Stream).Eq(popen.StderrStream)
+	verify.That(t, chunks[1].Data).Eq("two\n")
+}
+
+// CombinedOutput
+// ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// Combined output format
+
+func TestCombinedOutputFormat(t *testing.T) {
+	var t0 = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	var chunks = []popen.OutputChunk{
+		{Stream: popen.StdoutStream, Time: t0, Data: "partial"},
+		{Stream: popen.StderrStream, Time: t0.Add(time.Millisecond), Data: "multi\nline\n"},
+		{Stream: popen.StdoutStream, Time: t0.Add(2 * time.Millisecond), Data: ""},
+	}
+
+	var buf bytes.Buffer
+	err := popen.WriteCombinedOutput(&buf, chunks)
+	verify.That(t, err).IsError(nil)
+	verify.That(t, buf.String()).StartsWith(
+		"2024-01-02T03:04:05.000000006Z stdout 7\npartial\n" +
+			"2024-01-02T03:04:05.001000006Z stderr 11\nmulti\nline\n\n")
+
+	read, err := popen.ReadCombinedOutput(&buf)
+	verify.That(t, err).IsError(nil)
+	verify.That(t, read).Length().Eq(3)
+	for i := range chunks {
+		verify.That(t, read[i].Stream).Eq(chunks[i].Stream)
+		verify.That(t, read[i].Time.Equal(chunks[i].Time)).IsTrue()
+		verify.That(t, read[i].Data).Eq(chunks[i].Data)
+	}
+}
+
+func TestReadCombinedOutputInvalid(t *testing.T) {
+	_, err := popen.ReadCombinedOutput(strings.NewReader(
+		"2024-01-02T03:04:05Z stdout 10\nshort\n"))
+	verify.That(t, err).ToString().Contains("failed to read combined output chunk 1")
+
+	_, err = popen.ReadCombinedOutput(strings.NewReader(
+		"2024-01-02T03:04:05Z stdin 5\nshort\n"))
+	verify.That(t, err).ToString().Contains("invalid stream 'stdin'")
+}
+
+func TestReplayCombinedOutput(t *testing.T) {
+	var t0 = time.Now()
+	var chunks = []popen.OutputChunk{
+		{Stream: popen.StdoutStream, Time: t0, Data: "one\n"},
+		{Stream: popen.StderrStream, Time: t0.Add(50 * time.Millisecond), Data: "two\n"},
+		{Stream: popen.StdoutStream, Time: t0.Add(100 * time.Millisecond), Data: "three\n"},
+	}
+
+	var stdout, stderr bytes.Buffer
+	var start = time.Now()
+	err := popen.ReplayCombinedOutput(context.Background(), chunks, &stdout, &stderr)
+	verify.That(t, err).IsError(nil)
+	verify.That(t, time.Since(start).Seconds()).Ge(0.1)
+	verify.That(t, stdout.String()).Eq("one\nthree\n")
+	verify.That(t, stderr.String()).Eq("two\n")
+}
+
+// Combined output format
+// ---------------------------------------------------------------------------
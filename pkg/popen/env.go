@@ -0,0 +1,326 @@
+package popen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/maargenton/go-fileutils"
+)
+
+// Environment describes a set of changes to apply to the environment of a
+// command, on top of the environment inherited from the current process or
+// defined by `Command.Env`. Changes are recorded in order and applied each
+// time the command runs, so that values derived from existing variables, like
+// `Prepend()` or `Expand()`, are resolved against the actual environment at
+// that time. The zero value is an empty set of changes, ready to use.
+type Environment struct {
+	changes []func(env envMap)
+}
+
+// Set sets the variable name to value, used as is.
+func (e *Environment) Set(name, value string) {
+	e.add(func(env envMap) {
+		env.set(name, value)
+	})
+}
+
+// Expand sets the variable name to value, after expanding any reference to
+// other variables in the form `$VAR`, `${VAR}` or `${VAR:-default}` against
+// the environment at that point. Undefined variables expand to an empty
+// string, and `$$` expands to a literal `$`.
+func (e *Environment) Expand(name, value string) {
+	e.add(func(env envMap) {
+		env.set(name, expandEnv(value, env))
+	})
+}
+
+// Unset removes the variable name from the environment, including if it is
+// inherited from the current process.
+func (e *Environment) Unset(name string) {
+	e.add(func(env envMap) {
+		delete(env, envKey(name))
+	})
+}
+
+// Prepend adds value at the beginning of the PATH-like list variable name,
+// separated from the existing value, if any, by `os.PathListSeparator`.
+func (e *Environment) Prepend(name, value string) {
+	e.add(func(env envMap) {
+		if existing := env.get(name); existing != "" {
+			env.set(name, value+string(os.PathListSeparator)+existing)
+		} else {
+			env.set(name, value)
+		}
+	})
+}
+
+// Append adds value at the end of the PATH-like list variable name, separated
+// from the existing value, if any, by `os.PathListSeparator`.
+func (e *Environment) Append(name, value string) {
+	e.add(func(env envMap) {
+		if existing := env.get(name); existing != "" {
+			env.set(name, existing+string(os.PathListSeparator)+value)
+		} else {
+			env.set(name, value)
+		}
+	})
+}
+
+func (e *Environment) add(change func(env envMap)) {
+	e.changes = append(e.changes, change)
+}
+
+// LoadFile loads variable definitions from a `.env` file and records them as
+// changes to the environment. Each non-empty line that is not a `#` comment
+// must be in the form `NAME=value`, optionally preceded by `export`. Values
+// can be single-quoted, taken literally, or double-quoted, supporting `\n`,
+// `\t`, `\"`, `\\` and `\$` escape sequences. Variable references in unquoted
+// and double-quoted values are expanded as with `Expand()`.
+func (e *Environment) LoadFile(filename string) error {
+	err := fileutils.ReadFile(filename, func(r io.Reader) error {
+		var scanner = bufio.NewScanner(r)
+		for n := 1; scanner.Scan(); n++ {
+			if err := e.parseLine(scanner.Text()); err != nil {
+				return fmt.Errorf("line %v: %w", n, err)
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load env file '%v': %w", filename, err)
+	}
+	return nil
+}
+
+// parseLine parses a single line of a `.env` file and records the
+// corresponding change, if any.
+func (e *Environment) parseLine(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+	i := strings.IndexByte(line, '=')
+	if i < 0 {
+		return fmt.Errorf("missing '=' in '%v'", line)
+	}
+	var name, value = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+	if !isEnvName(name) {
+		return fmt.Errorf("invalid variable name '%v'", name)
+	}
+
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return fmt.Errorf("unterminated single-quoted value")
+		}
+		e.Set(name, value[1:end+1])
+
+	case strings.HasPrefix(value, `"`):
+		var template strings.Builder
+		var terminated bool
+		for i := 1; i < len(value) && !terminated; i++ {
+			switch c := value[i]; {
+			case c == '"':
+				terminated = true
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					template.WriteByte('\n')
+				case 't':
+					template.WriteByte('\t')
+				case '$':
+					template.WriteString("$$")
+				default:
+					template.WriteByte(value[i])
+				}
+			default:
+				template.WriteByte(c)
+			}
+		}
+		if !terminated {
+			return fmt.Errorf("unterminated double-quoted value")
+		}
+		e.Expand(name, template.String())
+
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		e.Expand(name, value)
+	}
+	return nil
+}
+
+// Apply applies all the changes to the base environment, a list of
+// `NAME=value` entries where later definitions take precedence, and returns
+// the resulting environment, sorted by variable name.
+func (e *Environment) Apply(base []string) []string {
+	var env = parseEnvList(base)
+	if e != nil {
+		for _, change := range e.changes {
+			change(env)
+		}
+	}
+	return env.render()
+}
+
+// EffectiveEnv returns the environment of the child process when running the
+// command, as a list of `NAME=value` entries sorted by variable name.
+func (c *Command) EffectiveEnv() []string {
+	var base []string
+	if !c.OverwriteEnv {
+		base = os.Environ()
+	}
+	return c.Environment.Apply(append(base, c.Env...))
+}
+
+// effectiveEnv returns the environment to pass to the child process, or nil if
+// it inherits the environment of the current process unchanged.
+func (c *Command) effectiveEnv() []string {
+	if len(c.Env) == 0 && c.Environment == nil {
+		return nil
+	}
+	return c.EffectiveEnv()
+}
+
+// EnvChanges returns the changes made by the command to the environment
+// inherited from the current process, as sorted `NAME=value` entries for the
+// variables that are set or modified, and the sorted names of the variables
+// that are removed. If the command specifies only `Env`, set is `Env` as is. If
+// `OverwriteEnv` is set, set is the complete environment of the command and
+// unset is empty.
+func (c *Command) EnvChanges() (set, unset []string) {
+	if c.Environment == nil {
+		return c.Env, nil
+	}
+	if c.OverwriteEnv {
+		return c.EffectiveEnv(), nil
+	}
+
+	var base = parseEnvList(os.Environ())
+	var env = parseEnvList(c.EffectiveEnv())
+	for _, entry := range env.render() {
+		var name, value = splitEnvEntry(entry)
+		if existing, ok := base[envKey(name)]; !ok || existing.value != value {
+			set = append(set, entry)
+		}
+	}
+	for key, v := range base {
+		if _, ok := env[key]; !ok {
+			unset = append(unset, v.name)
+		}
+	}
+	sort.Strings(unset)
+	return set, unset
+}
+
+// envMap is a set of environment variables indexed by name, case-insensitively
+// on Windows, that preserves the case of the names.
+type envMap map[string]envVar
+
+type envVar struct {
+	name, value string
+}
+
+// get returns the value of the variable name, or an empty string if it is not
+// defined.
+func (m envMap) get(name string) string {
+	return m[envKey(name)].value
+}
+
+// lookup returns the value of the variable name, and whether it is defined.
+func (m envMap) lookup(name string) (string, bool) {
+	v, ok := m[envKey(name)]
+	return v.value, ok
+}
+
+// set sets the variable name to value, keeping the case of its existing name
+// if already defined.
+func (m envMap) set(name, value string) {
+	var key = envKey(name)
+	if existing, ok := m[key]; ok {
+		name = existing.name
+	}
+	m[key] = envVar{name: name, value: value}
+}
+
+// render returns the variables as a list of `NAME=value` entries, sorted by
+// name.
+func (m envMap) render() []string {
+	var vars = make([]envVar, 0, len(m))
+	for _, v := range m {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].name < vars[j].name
+	})
+
+	var list = make([]string, 0, len(vars))
+	for _, v := range vars {
+		list = append(list, v.name+"="+v.value)
+	}
+	return list
+}
+
+// parseEnvList parses a list of `NAME=value` entries where later definitions
+// take precedence.
+func parseEnvList(list []string) envMap {
+	var env = make(envMap, len(list))
+	for _, entry := range list {
+		var name, value = splitEnvEntry(entry)
+		env[envKey(name)] = envVar{name: name, value: value}
+	}
+	return env
+}
+
+// splitEnvEntry splits a `NAME=value` entry into its name and value. A leading
+// `=` is part of the name, as in the `=C:=C:\dir` entries defined on Windows.
+func splitEnvEntry(entry string) (name, value string) {
+	var i = strings.IndexByte(entry, '=')
+	if i == 0 {
+		if i = strings.IndexByte(entry[1:], '='); i >= 0 {
+			i++
+		}
+	}
+	if i < 0 {
+		return entry, ""
+	}
+	return entry[:i], entry[i+1:]
+}
+
+// expandEnv expands the variable references in s against env.
+func expandEnv(s string, env envMap) string {
+	return os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		if i := strings.Index(name, ":-"); i >= 0 {
+			if value := env.get(name[:i]); value != "" {
+				return value
+			}
+			return name[i+2:]
+		}
+		return env.get(name)
+	})
+}
+
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') &&
+			!(i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
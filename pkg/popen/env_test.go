@@ -0,0 +1,155 @@
+package popen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestEnvironmentApply(t *testing.T) {
+	var sep = string(os.PathListSeparator)
+	var env popen.Environment
+	env.Set("FOO", "foo")
+	env.Unset("BAR")
+	env.Prepend("PATH", "/opt/bin")
+	env.Append("PATH", "/usr/local/bin")
+	env.Append("EMPTY", "/a")
+	env.Expand("GREETING", "hello ${NAME}, ${MISSING:-default} $$FOO")
+	env.Set("LITERAL", "$FOO")
+
+	var result = env.Apply([]string{
+		"PATH=/usr/bin",
+		"BAR=bar",
+		"NAME=first",
+		"NAME=second",
+	})
+	verify.That(t, result).Eq([]string{
+		"EMPTY=/a",
+		"FOO=foo",
+		"GREETING=hello second, default $FOO",
+		"LITERAL=$FOO",
+		"NAME=second",
+		"PATH=/opt/bin" + sep + "/usr/bin" + sep + "/usr/local/bin",
+	})
+}
+
+func TestEnvironmentApplyIsRepeatable(t *testing.T) {
+	var env popen.Environment
+	env.Prepend("PATH", "/opt/bin")
+
+	var base = []string{"PATH=/usr/bin"}
+	verify.That(t, env.Apply(base)).Eq(env.Apply(base))
+}
+
+func TestEnvironmentApplyDriveEntries(t *testing.T) {
+	var env popen.Environment
+	var result = env.Apply([]string{`=C:=C:\dir`, `=D:=D:\`})
+	verify.That(t, result).Eq([]string{`=C:=C:\dir`, `=D:=D:\`})
+}
+
+func TestCommandEnvChanges(t *testing.T) {
+	t.Setenv("POPEN_TEST_KEPT", "kept")
+	t.Setenv("POPEN_TEST_CHANGED", "before")
+	t.Setenv("POPEN_TEST_REMOVED", "removed")
+
+	var env popen.Environment
+	env.Set("POPEN_TEST_KEPT", "kept")
+	env.Set("POPEN_TEST_CHANGED", "after")
+	env.Set("POPEN_TEST_ADDED", "added")
+	env.Unset("POPEN_TEST_REMOVED")
+	var cmd = popen.Command{
+		Command:     "env",
+		Environment: &env,
+	}
+
+	set, unset := cmd.EnvChanges()
+	verify.That(t, set).Eq([]string{
+		"POPEN_TEST_ADDED=added",
+		"POPEN_TEST_CHANGED=after",
+	})
+	verify.That(t, unset).Eq([]string{"POPEN_TEST_REMOVED"})
+	verify.That(t, cmd.String()).Eq(
+		"env -u POPEN_TEST_REMOVED POPEN_TEST_ADDED=added POPEN_TEST_CHANGED=after env")
+}
+
+func TestEnvironmentLoadFile(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, ".env")
+	ioutil.WriteFile(filename, []byte(`
+# Comment
+FOO=foo
+export BAR = bar value # trailing comment
+SINGLE='${FOO} \n'
+DOUBLE="${FOO}\t\"quoted\" \$FOO"
+DERIVED=${BAR}-${HOME_DIR:-/home}
+`), 0644)
+
+	var env popen.Environment
+	err := env.LoadFile(filename)
+	verify.That(t, err).IsNil()
+	verify.That(t, env.Apply(nil)).Eq([]string{
+		"BAR=bar value",
+		"DERIVED=bar value-/home",
+		"DOUBLE=foo\t\"quoted\" $FOO",
+		"FOO=foo",
+		`SINGLE=${FOO} \n`,
+	})
+}
+
+func TestEnvironmentLoadFileErrors(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, ".env")
+	var contents = []string{
+		"FOO",
+		"1FOO=bar",
+		"FOO='bar",
+		`FOO="bar`,
+	}
+
+	for _, content := range contents {
+		t.Run(content, func(t *testing.T) {
+			ioutil.WriteFile(filename, []byte(content), 0644)
+			var env popen.Environment
+			err := env.LoadFile(filename)
+			verify.That(t, err).ToString().StartsWith("failed to load env file")
+			verify.That(t, err).ToString().Contains("line 1")
+		})
+	}
+
+	var env popen.Environment
+	err := env.LoadFile(fileutils.Join(tmp, "missing.env"))
+	verify.That(t, err).IsError(os.ErrNotExist)
+}
+
+func TestCommandEnvironment(t *testing.T) {
+	os.Setenv("POPEN_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("POPEN_TEST_INHERITED")
+
+	var env popen.Environment
+	env.Unset("POPEN_TEST_INHERITED")
+	env.Expand("POPEN_TEST_DERIVED", "${POPEN_TEST_FOO}-derived")
+
+	var cmd = popen.Command{
+		Command:     "env",
+		Env:         []string{"POPEN_TEST_FOO=foo"},
+		Environment: &env,
+	}
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+
+	var childEnv = parseEnv(stdout)
+	_, inherited := childEnv["POPEN_TEST_INHERITED"]
+	verify.That(t, inherited).IsFalse()
+	verify.That(t, childEnv["POPEN_TEST_FOO"]).Eq("foo")
+	verify.That(t, childEnv["POPEN_TEST_DERIVED"]).Eq("foo-derived")
+
+	var effective = cmd.EffectiveEnv()
+	verify.That(t, effective).IsSupersetOf([]string{"POPEN_TEST_DERIVED=foo-derived"})
+	verify.That(t, effective).IsDisjointSetFrom([]string{"POPEN_TEST_INHERITED=inherited"})
+}
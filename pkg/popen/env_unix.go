@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package popen
+
+// envKey returns the key identifying the environment variable name, which is
+// case-sensitive.
+func envKey(name string) string {
+	return name
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package popen
+
+import "strings"
+
+// envKey returns the key identifying the environment variable name, which is
+// case-insensitive on Windows.
+func envKey(name string) string {
+	return strings.ToUpper(name)
+}
@@ -0,0 +1,106 @@
+package popen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultStderrTailBytes is the number of bytes of stderr retained for
+// inclusion into an *ExitError when only `StderrTailLines` is specified.
+const DefaultStderrTailBytes = 4096
+
+// ExitError is the error returned when a command exits with a non-zero status
+// and either `StderrTailBytes` or `StderrTailLines` is specified. It wraps the
+// original *exec.ExitError, which remains accessible through `errors.As()`.
+type ExitError struct {
+	// Err is the original error reporting the non-zero exit status, an
+	// *exec.ExitError unless the command is executed by an alternate Runner.
+	Err error
+
+	// CommandLine is the command line of the failed command.
+	CommandLine string
+
+	// StderrTail is the tail of the stderr stream of the failed command.
+	StderrTail string
+}
+
+func (e *ExitError) Error() string {
+	var msg = fmt.Sprintf("command failed: %v: %v", e.CommandLine, e.Err)
+	if tail := strings.TrimRight(e.StderrTail, "\n"); tail != "" {
+		msg += ":\n" + tail
+	}
+	return msg
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit status of the failed command.
+func (e *ExitError) ExitCode() int {
+	if err, ok := e.Err.(exitCoder); ok {
+		return err.ExitCode()
+	}
+	return -1
+}
+
+// lastLines returns the last n lines of s, or s if n is not positive.
+func lastLines(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	var i = len(strings.TrimSuffix(s, "\n"))
+	for ; n > 0 && i >= 0; n-- {
+		i = strings.LastIndexByte(s[:i], '\n')
+	}
+	return s[i+1:]
+}
+
+// tailBuffer is an io.Writer that retains only the last bytes written into it,
+// up to a fixed size.
+type tailBuffer struct {
+	buf     []byte
+	pos     int
+	full    bool
+	written int64
+}
+
+func newTailBuffer(size int) *tailBuffer {
+	return &tailBuffer{buf: make([]byte, size)}
+}
+
+func (b *tailBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	b.written += int64(n)
+	if len(p) >= len(b.buf) {
+		copy(b.buf, p[len(p)-len(b.buf):])
+		b.pos, b.full = 0, true
+		return
+	}
+
+	var c = copy(b.buf[b.pos:], p)
+	if c < len(p) {
+		copy(b.buf, p[c:])
+	}
+	if b.pos+len(p) >= len(b.buf) {
+		b.full = true
+	}
+	b.pos = (b.pos + len(p)) % len(b.buf)
+	return
+}
+
+func (b *tailBuffer) String() string {
+	if !b.full {
+		return string(b.buf[:b.pos])
+	}
+	return string(b.buf[b.pos:]) + string(b.buf[:b.pos])
+}
+
+// Dropped returns the number of bytes written into the buffer that are no
+// longer retained.
+func (b *tailBuffer) Dropped() int64 {
+	if b.full {
+		return b.written - int64(len(b.buf))
+	}
+	return b.written - int64(b.pos)
+}
@@ -0,0 +1,37 @@
+package popen
+
+import (
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+)
+
+func TestTailBuffer(t *testing.T) {
+	var b = newTailBuffer(8)
+	b.Write([]byte("abc"))
+	verify.That(t, b.String()).Eq("abc")
+	b.Write([]byte("defgh"))
+	verify.That(t, b.String()).Eq("abcdefgh")
+	b.Write([]byte("ijk"))
+	verify.That(t, b.String()).Eq("defghijk")
+	b.Write([]byte("0123456789"))
+	verify.That(t, b.String()).Eq("23456789")
+}
+
+func TestLastLines(t *testing.T) {
+	verify.That(t, lastLines("a\nb\nc\n", 2)).Eq("b\nc\n")
+	verify.That(t, lastLines("a\nb\nc", 2)).Eq("b\nc")
+	verify.That(t, lastLines("a\nb\nc\n", 5)).Eq("a\nb\nc\n")
+	verify.That(t, lastLines("a\nb\nc\n", 0)).Eq("a\nb\nc\n")
+	verify.That(t, lastLines("", 1)).Eq("")
+}
+
+func TestTailBufferDropped(t *testing.T) {
+	var b = newTailBuffer(8)
+	b.Write([]byte("abc"))
+	verify.That(t, b.Dropped()).Eq(int64(0))
+	b.Write([]byte("defghijk"))
+	verify.That(t, b.Dropped()).Eq(int64(3))
+	b.Write([]byte("0123456789"))
+	verify.That(t, b.Dropped()).Eq(int64(13))
+}
@@ -0,0 +1,72 @@
+package popen_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestExitErrorStderrTail(t *testing.T) {
+	var tmp = tempDir(t)
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"for i in {1..10}; do echo Error $i 1>&2; done; exit 2",
+		},
+		WriteStderrToFile: fileutils.Join(tmp, "stderr.txt"),
+		StderrTailLines:   2,
+	}
+
+	_, stderr, err := cmd.Run(context.Background())
+	verify.That(t, stderr).Eq("")
+
+	var exitErr *popen.ExitError
+	verify.That(t, errors.As(err, &exitErr)).IsTrue()
+	verify.That(t, exitErr.StderrTail).Eq("Error 9\nError 10\n")
+	verify.That(t, exitErr.ExitCode()).Eq(2)
+	verify.That(t, err).ToString().Eq(
+		"command failed: bash -c 'for i in {1..10}; do echo Error $i 1>&2; done; exit 2': " +
+			"exit status 2:\nError 9\nError 10")
+
+	var execExitErr *exec.ExitError
+	verify.That(t, errors.As(err, &execExitErr)).IsTrue()
+	verify.That(t, execExitErr.ExitCode()).Eq(2)
+}
+
+func TestExitErrorStderrTailBytes(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo Hello World 1>&2; exit 1",
+		},
+		DiscardStderr:   true,
+		StderrTailBytes: 6,
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	var exitErr *popen.ExitError
+	verify.That(t, errors.As(err, &exitErr)).IsTrue()
+	verify.That(t, exitErr.StderrTail).Eq("World\n")
+}
+
+func TestExitErrorNotUsedByDefault(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"exit 1",
+		},
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	var exitErr *popen.ExitError
+	verify.That(t, errors.As(err, &exitErr)).IsFalse()
+}
@@ -0,0 +1,69 @@
+package popen
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ExtraFile describes an additional file descriptor inherited by the child
+// process, as specified in `Command.ExtraFiles`.
+type ExtraFile struct {
+	// File, if specified, is passed to the child process as is. It remains
+	// owned by the caller and is not closed by the command.
+	File *os.File
+
+	// Reader, if `File` is not specified, is expected to read from r the
+	// content written by the child process to the file descriptor, through a
+	// pipe. If it returns an error, the command is aborted.
+	Reader func(r io.Reader) error
+}
+
+// setupExtraFiles configures the extra files of the command, creating a pipe
+// and a servicer for each extra file read by a `Reader`.
+func (e *execution) setupExtraFiles() error {
+	for i, extra := range e.c.ExtraFiles {
+		if extra.File != nil {
+			e.inv.ExtraFiles = append(e.inv.ExtraFiles, extra.File)
+			continue
+		}
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to create pipe for fd %v: %w", 3+i, err)
+		}
+		e.inv.ExtraFiles = append(e.inv.ExtraFiles, w)
+		e.closeAfterStart = append(e.closeAfterStart, w)
+		e.closeIfNotStarted = append(e.closeIfNotStarted, r)
+
+		var handler = extra.Reader
+		e.servicers = append(e.servicers, func() {
+			var err error
+			if handler != nil {
+				err = handler(r)
+			}
+			if err != nil && err != io.EOF {
+				e.cancel()
+			}
+			drain(r)
+			r.Close()
+			e.servicerErrors <- err
+		})
+	}
+	return nil
+}
+
+// closeStartFiles closes the files that are no longer needed once the child
+// process is started, or all the files prepared for the child process if
+// started is false.
+func (e *execution) closeStartFiles(started bool) {
+	for _, c := range e.closeAfterStart {
+		c.Close()
+	}
+	if !started {
+		for _, c := range e.closeIfNotStarted {
+			c.Close()
+		}
+	}
+	e.closeAfterStart, e.closeIfNotStarted = nil, nil
+}
@@ -0,0 +1,128 @@
+//go:build !windows
+// +build !windows
+
+package popen_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestCommandStdoutStderrWriter(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	var cmd = popen.Command{
+		Command:      "bash",
+		Arguments:    []string{"-c", "echo out; echo err >&2"},
+		StdoutWriter: &stdout,
+		StderrWriter: &stderr,
+	}
+	out, errOut, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, stdout.String()).Eq("out\n")
+	verify.That(t, stderr.String()).Eq("err\n")
+	verify.That(t, out).Eq("out\n")
+	verify.That(t, errOut).Eq("err\n")
+}
+
+func TestCommandStdoutWriterFileNotClosed(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "stdout.log")
+	f, err := os.Create(filename)
+	verify.That(t, err).IsError(nil)
+	defer f.Close()
+
+	var cmd = popen.Command{
+		Command:       "echo",
+		Arguments:     []string{"one"},
+		StdoutWriter:  f,
+		DiscardStdout: true,
+	}
+	_, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	_, err = f.WriteString("two\n")
+	verify.That(t, err).IsError(nil)
+	verify.That(t, readFile(t, filename)).Eq("one\ntwo\n")
+}
+
+func TestCommandStdoutWriterFilePassedDirectly(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "stdout.log")
+	f, err := os.Create(filename)
+	verify.That(t, err).IsError(nil)
+	defer f.Close()
+
+	var cmd = popen.Command{
+		Command:       "bash",
+		Arguments:     []string{"-c", "if [ -p /dev/stdout ]; then echo pipe; else echo file; fi"},
+		StdoutWriter:  f,
+		DiscardStdout: true,
+	}
+	_, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, readFile(t, filename)).Eq("file\n")
+}
+
+func TestCommandExtraFiles(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "fd3.log")
+	f, err := os.Create(filename)
+	verify.That(t, err).IsError(nil)
+	defer f.Close()
+
+	var status string
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "echo file >&3; echo ready >&4; echo out"},
+		ExtraFiles: []popen.ExtraFile{
+			{File: f},
+			{Reader: func(r io.Reader) error {
+				content, err := ioutil.ReadAll(r)
+				status = string(content)
+				return err
+			}},
+		},
+	}
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, stdout).Eq("out\n")
+	verify.That(t, status).Eq("ready\n")
+	verify.That(t, readFile(t, filename)).Eq("file\n")
+
+	_, err = f.WriteString("still open\n")
+	verify.That(t, err).IsError(nil)
+}
+
+func TestCommandExtraFilesReaderError(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "echo bad >&3; sleep 3"},
+		ExtraFiles: []popen.ExtraFile{
+			{Reader: func(r io.Reader) error {
+				return errors.New("bad status")
+			}},
+		},
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).ToString().Eq("bad status")
+}
+
+func TestCommandExtraFilesStartFailure(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "no-such-command-xyz",
+		ExtraFiles: []popen.ExtraFile{
+			{Reader: func(r io.Reader) error { return nil }},
+		},
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(popen.ErrExecutableNotFound)
+}
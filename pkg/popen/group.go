@@ -0,0 +1,156 @@
+package popen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Group runs multiple independent commands concurrently, with a bounded number
+// of commands running at any time.
+type Group struct {
+	// Commands is the list of commands to run.
+	Commands []Command
+
+	// Concurrency is the maximum number of commands running concurrently. It
+	// defaults to the number of CPUs if not set explicitly.
+	Concurrency int
+
+	// FailFast, if true, causes all the other commands to be aborted as soon as
+	// one command fails, through the shutdown sequence defined in each
+	// command. Commands that have not been started yet are skipped. By
+	// default, all commands are run regardless of failures.
+	FailFast bool
+
+	// Output, if not nil, receives all the lines of stdout and stderr of all
+	// the commands as they are produced, each prefixed with the label of its
+	// command. This does not affect the other output options of the commands.
+	Output io.Writer
+
+	// Labels optionally defines the labels used to prefix the lines written to
+	// `Output`, matching `Commands` by index. The label defaults to the name of
+	// the command.
+	Labels []string
+}
+
+// GroupError is the error returned when one or more commands of a Group fail.
+type GroupError struct {
+	// Errors contains the errors returned by each command of the group, in
+	// order, with nil entries for the commands that succeeded.
+	Errors []error
+}
+
+func (e *GroupError) Error() string {
+	var count, first = 0, -1
+	for i, err := range e.Errors {
+		if err != nil {
+			if first < 0 {
+				first = i
+			}
+			count++
+		}
+	}
+	return fmt.Sprintf("%v of %v commands failed, first error from command %v: %v",
+		count, len(e.Errors), first, e.Errors[first])
+}
+
+// Unwrap returns the error of the first failed command, in input order.
+func (e *GroupError) Unwrap() error {
+	for _, err := range e.Errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunAll runs all the commands concurrently, with at most concurrency commands
+// running at any time, and returns their results in input order. It is a
+// shorthand for running a Group in keep-going mode.
+func RunAll(ctx context.Context, concurrency int, cmds ...Command) ([]*Result, error) {
+	var g = Group{
+		Commands:    cmds,
+		Concurrency: concurrency,
+	}
+	return g.Run(ctx)
+}
+
+// Run runs all the commands of the group and returns their results in input
+// order, with nil entries for commands that could not be started or were
+// skipped. If any command fails, the returned error is a *GroupError that
+// carries the error of every command.
+func (g *Group) Run(ctx context.Context) ([]*Result, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var concurrency = g.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	var results = make([]*Result, len(g.Commands))
+	var errs = make([]error, len(g.Commands))
+	var outputMutex sync.Mutex
+	var sem = make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range g.Commands {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		var c = g.Commands[i]
+		if g.Output != nil {
+			var label = c.Command
+			if i < len(g.Labels) {
+				label = g.Labels[i]
+			}
+			c.StdoutLineHandler = g.labelLines(label, c.StdoutLineHandler, &outputMutex)
+			c.StderrLineHandler = g.labelLines(label, c.StderrLineHandler, &outputMutex)
+		}
+
+		wg.Add(1)
+		go func(i int, c Command) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = c.RunResult(ctx)
+			if errs[i] != nil && g.FailFast {
+				cancel()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return results, &GroupError{Errors: errs}
+		}
+	}
+	return results, nil
+}
+
+// labelLines returns a line handler that writes each line into the output of
+// the group with the specified label, after passing it to handler if not nil.
+func (g *Group) labelLines(label string, handler func(line string) error, mutex *sync.Mutex) func(line string) error {
+	return func(line string) error {
+		if handler != nil {
+			if err := handler(line); err != nil {
+				return err
+			}
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		_, err := fmt.Fprintf(g.Output, "[%v] %v\n", label, line)
+		return err
+	}
+}
@@ -0,0 +1,118 @@
+package popen_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestRunAll(t *testing.T) {
+	results, err := popen.RunAll(context.Background(), 2,
+		popen.Command{Command: "echo", Arguments: []string{"foo"}},
+		popen.Command{Command: "bash", Arguments: []string{"-c", "sleep 0.1; echo bar"}},
+		popen.Command{Command: "echo", Arguments: []string{"baz"}},
+	)
+	verify.That(t, err).IsNil()
+	verify.That(t, results).Length().Eq(3)
+	verify.That(t, results[0].Stdout).Eq("foo\n")
+	verify.That(t, results[1].Stdout).Eq("bar\n")
+	verify.That(t, results[2].Stdout).Eq("baz\n")
+}
+
+func TestGroupConcurrency(t *testing.T) {
+	var cmd = popen.Command{Command: "sleep", Arguments: []string{"0.2"}}
+	var g = popen.Group{
+		Commands:    []popen.Command{cmd, cmd, cmd, cmd},
+		Concurrency: 2,
+	}
+
+	var start = time.Now()
+	_, err := g.Run(context.Background())
+	var elapsed = time.Since(start).Seconds()
+	verify.That(t, err).IsNil()
+	verify.That(t, elapsed).Ge(0.4)
+	verify.That(t, elapsed).Lt(0.8)
+}
+
+func TestGroupKeepGoing(t *testing.T) {
+	var g = popen.Group{
+		Commands: []popen.Command{
+			{Command: "bash", Arguments: []string{"-c", "exit 2"}},
+			{Command: "bash", Arguments: []string{"-c", "sleep 0.1; echo done"}},
+		},
+	}
+
+	results, err := g.Run(context.Background())
+	var groupErr *popen.GroupError
+	verify.That(t, errors.As(err, &groupErr)).IsTrue()
+	verify.That(t, groupErr.Errors[0]).ToString().Eq("exit status 2")
+	verify.That(t, groupErr.Errors[1]).IsNil()
+	verify.That(t, results[0].ExitCode).Eq(2)
+	verify.That(t, results[1].Stdout).Eq("done\n")
+	verify.That(t, err).ToString().Eq(
+		"1 of 2 commands failed, first error from command 0: exit status 2")
+}
+
+func TestGroupFailFast(t *testing.T) {
+	var g = popen.Group{
+		Commands: []popen.Command{
+			{Command: "sleep", Arguments: []string{"10"}},
+			{Command: "bash", Arguments: []string{"-c", "exit 2"}},
+			{Command: "sleep", Arguments: []string{"10"}},
+		},
+		Concurrency: 2,
+		FailFast:    true,
+	}
+
+	var start = time.Now()
+	results, err := g.Run(context.Background())
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+
+	var groupErr *popen.GroupError
+	verify.That(t, errors.As(err, &groupErr)).IsTrue()
+	verify.That(t, groupErr.Errors[0]).IsNotNil()
+	verify.That(t, groupErr.Errors[1]).ToString().Eq("exit status 2")
+	verify.That(t, groupErr.Errors[2]).IsError(context.Canceled)
+	verify.That(t, results[0].Shutdown).IsTrue()
+	verify.That(t, results[2]).IsNil()
+}
+
+func TestGroupLabeledOutput(t *testing.T) {
+	var output strings.Builder
+	var lines []string
+	var g = popen.Group{
+		Commands: []popen.Command{
+			{Command: "bash", Arguments: []string{"-c", "echo foo; echo bar 1>&2"}},
+			{
+				Command:   "echo",
+				Arguments: []string{"baz"},
+				StdoutLineHandler: func(line string) error {
+					lines = append(lines, line)
+					return nil
+				},
+			},
+		},
+		Output: &output,
+		Labels: []string{"first"},
+	}
+
+	results, err := g.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, results[0].Stdout).Eq("foo\n")
+	verify.That(t, lines).Eq([]string{"baz"})
+
+	var outputLines = strings.Split(strings.TrimSpace(output.String()), "\n")
+	sort.Strings(outputLines)
+	verify.That(t, outputLines).Eq([]string{
+		"[echo] baz",
+		"[first] bar",
+		"[first] foo",
+	})
+}
@@ -0,0 +1,183 @@
+package popen
+
+import (
+	"context"
+	"sync"
+	"syscall"
+)
+
+// Hooks defines callbacks invoked at various stages of the execution of
+// commands, typically for logging or tracing purposes. All callbacks are
+// optional. Each one receives the invocation of the command, which is the
+// same for all the callbacks of a single execution and carries its context.
+// Callbacks run synchronously with the execution and should return promptly.
+type Hooks struct {
+	// OnStart is called after the command is started, with the process id of
+	// the child process, if any.
+	OnStart func(inv *Invocation, pid int)
+
+	// OnExit is called after the command completes, with its result and the
+	// error returned to the caller. The result is nil if the command could
+	// not be started.
+	OnExit func(inv *Invocation, result *Result, err error)
+
+	// OnSignal is called for each signal sent to the command as part of its
+	// shutdown sequence, before sending it.
+	OnSignal func(inv *Invocation, signal syscall.Signal)
+
+	// OnOutputChunk is called for every chunk written by the command to stdout
+	// or stderr, as received. Calls are serialized across both streams.
+	OnOutputChunk func(inv *Invocation, chunk OutputChunk)
+}
+
+var packageHooks struct {
+	mutex sync.Mutex
+	hooks []*Hooks
+}
+
+// RegisterHooks registers hooks that are invoked for every command executed
+// through this package, before the `Hooks` of the command itself, and returns
+// a function that unregisters them.
+func RegisterHooks(hooks *Hooks) (unregister func()) {
+	packageHooks.mutex.Lock()
+	defer packageHooks.mutex.Unlock()
+	packageHooks.hooks = append(packageHooks.hooks, hooks)
+
+	return func() {
+		packageHooks.mutex.Lock()
+		defer packageHooks.mutex.Unlock()
+		var remaining []*Hooks
+		for _, h := range packageHooks.hooks {
+			if h != hooks {
+				remaining = append(remaining, h)
+			}
+		}
+		packageHooks.hooks = remaining
+	}
+}
+
+// effectiveHooks returns all the hooks applicable to the command, package
+// hooks first.
+func (c *Command) effectiveHooks() []*Hooks {
+	packageHooks.mutex.Lock()
+	var hooks = append([]*Hooks(nil), packageHooks.hooks...)
+	packageHooks.mutex.Unlock()
+
+	if c.Hooks != nil {
+		hooks = append(hooks, c.Hooks)
+	}
+	return hooks
+}
+
+// hasOutputChunkHook returns true if any of hooks defines OnOutputChunk.
+func hasOutputChunkHook(hooks []*Hooks) bool {
+	for _, h := range hooks {
+		if h.OnOutputChunk != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *execution) onStart(pid int) {
+	for _, h := range e.hooks {
+		if h.OnStart != nil {
+			h.OnStart(&e.inv, pid)
+		}
+	}
+}
+
+// releaseOutputChunks delivers any output chunk held until the OnStart hooks
+// have returned to the OnOutputChunk hooks.
+func (e *execution) releaseOutputChunks() {
+	if e.combined != nil {
+		e.combined.release()
+	}
+}
+
+func (e *execution) onExit(result *Result, err error) {
+	for _, h := range e.hooks {
+		if h.OnExit != nil {
+			h.OnExit(&e.inv, result, err)
+		}
+	}
+}
+
+func (e *execution) onOutputChunk(chunk OutputChunk) {
+	for _, h := range e.hooks {
+		if h.OnOutputChunk != nil {
+			h.OnOutputChunk(&e.inv, chunk)
+		}
+	}
+}
+
+// NotifySignal invokes the `OnSignal` hooks applicable to the execution.
+// Runner implementations must call it before sending each signal of the
+// shutdown sequence of the execution, including the final kill.
+func (inv *Invocation) NotifySignal(signal syscall.Signal) {
+	if inv.e == nil {
+		return
+	}
+	for _, h := range inv.e.hooks {
+		if h.OnSignal != nil {
+			h.OnSignal(inv, signal)
+		}
+	}
+}
+
+// Logger is the interface through which `LogHooks()` reports the execution of
+// commands. It is a subset of the methods of `*slog.Logger`, where args are
+// alternating keys and values.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+	InfoContext(ctx context.Context, msg string, args ...interface{})
+	WarnContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// LogHooks returns hooks that log the start, shutdown signals and exit of
+// commands to logger, as structured records with the command, its arguments,
+// directory, process id, duration and exit status. Successful runs are logged
+// at info level, failures and shutdown signals at warning level, and starts at
+// debug level. Output chunks are not logged.
+func LogHooks(logger Logger) *Hooks {
+	return &Hooks{
+		OnStart: func(inv *Invocation, pid int) {
+			logger.DebugContext(inv.Context, "command started",
+				commandAttrs(inv, "pid", pid)...)
+		},
+		OnSignal: func(inv *Invocation, signal syscall.Signal) {
+			logger.WarnContext(inv.Context, "command shutdown signal",
+				commandAttrs(inv, "signal", signal.String())...)
+		},
+		OnExit: func(inv *Invocation, result *Result, err error) {
+			var args []interface{}
+			if result != nil {
+				args = append(args,
+					"duration", result.Duration,
+					"exit_code", result.ExitCode)
+				if result.Signal != 0 {
+					args = append(args, "signal", result.Signal.String())
+				}
+			}
+			if err != nil {
+				args = append(args, "error", err.Error())
+				logger.WarnContext(inv.Context, "command failed",
+					commandAttrs(inv, args...)...)
+				return
+			}
+			logger.InfoContext(inv.Context, "command completed",
+				commandAttrs(inv, args...)...)
+		},
+	}
+}
+
+// commandAttrs returns the key-value pairs that identify the command of inv,
+// followed by args.
+func commandAttrs(inv *Invocation, args ...interface{}) []interface{} {
+	var c = inv.Command
+	var attrs = []interface{}{"command", c.Command, "args", c.Arguments}
+	if c.Directory != "" {
+		attrs = append(attrs, "dir", c.Directory)
+	}
+	return append(attrs, args...)
+}
@@ -0,0 +1,163 @@
+package popen_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestCommandHooks(t *testing.T) {
+	var mutex sync.Mutex
+	var events []string
+	var invs = map[*popen.Invocation]bool{}
+	var record = func(inv *popen.Invocation, event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		invs[inv] = true
+		events = append(events, event)
+	}
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "echo out; sleep 0.05; echo err >&2; exit 2"},
+		Hooks: &popen.Hooks{
+			OnStart: func(inv *popen.Invocation, pid int) {
+				// Output chunks must wait for a slow OnStart to return
+				time.Sleep(20 * time.Millisecond)
+				record(inv, fmt.Sprintf("start %v", pid > 0))
+			},
+			OnOutputChunk: func(inv *popen.Invocation, chunk popen.OutputChunk) {
+				record(inv, fmt.Sprintf("%v %q", chunk.Stream, chunk.Data))
+			},
+			OnExit: func(inv *popen.Invocation, result *popen.Result, err error) {
+				record(inv, fmt.Sprintf("exit %v %v", result.ExitCode, err))
+			},
+		},
+	}
+	stdout, stderr, err := cmd.Run(context.Background())
+	verify.That(t, err).ToString().Eq("exit status 2")
+	verify.That(t, stdout).Eq("out\n")
+	verify.That(t, stderr).Eq("err\n")
+	verify.That(t, invs).Length().Eq(1)
+	verify.That(t, events).Eq([]string{
+		"start true",
+		`stdout "out\n"`,
+		`stderr "err\n"`,
+		"exit 2 exit status 2",
+	})
+}
+
+func TestCommandHooksStartFailure(t *testing.T) {
+	var exits []string
+	var cmd = popen.Command{
+		Command: "no-such-command-xyz",
+		Hooks: &popen.Hooks{
+			OnStart: func(inv *popen.Invocation, pid int) {
+				t.Errorf("unexpected OnStart")
+			},
+			OnExit: func(inv *popen.Invocation, result *popen.Result, err error) {
+				exits = append(exits, fmt.Sprintf("%v %v", result == nil, err != nil))
+			},
+		},
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(popen.ErrExecutableNotFound)
+	verify.That(t, exits).Eq([]string{"true true"})
+}
+
+func TestRegisterHooks(t *testing.T) {
+	var mutex sync.Mutex
+	var commands []string
+	var unregister = popen.RegisterHooks(&popen.Hooks{
+		OnExit: func(inv *popen.Invocation, result *popen.Result, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			commands = append(commands, inv.Command.Command+" global")
+		},
+	})
+	var cmd = popen.Command{
+		Command: "echo",
+		Hooks: &popen.Hooks{
+			OnExit: func(inv *popen.Invocation, result *popen.Result, err error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				commands = append(commands, inv.Command.Command+" local")
+			},
+		},
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+
+	unregister()
+	_, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, commands).Eq([]string{"echo global", "echo local", "echo local"})
+}
+
+// ---------------------------------------------------------------------------
+// LogHooks
+
+type logRecord struct {
+	level string
+	msg   string
+	args  map[string]interface{}
+}
+
+type testLogger struct {
+	records []logRecord
+}
+
+func (l *testLogger) log(level, msg string, args []interface{}) {
+	var record = logRecord{level: level, msg: msg, args: map[string]interface{}{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		record.args[args[i].(string)] = args[i+1]
+	}
+	l.records = append(l.records, record)
+}
+
+func (l *testLogger) DebugContext(ctx context.Context, msg string, args ...interface{}) {
+	l.log("debug", msg, args)
+}
+
+func (l *testLogger) InfoContext(ctx context.Context, msg string, args ...interface{}) {
+	l.log("info", msg, args)
+}
+
+func (l *testLogger) WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	l.log("warn", msg, args)
+}
+
+func TestLogHooks(t *testing.T) {
+	var logger = &testLogger{}
+	var tmp = tempDir(t)
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "exit 3"},
+		Directory: tmp,
+		Hooks:     popen.LogHooks(logger),
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).ToString().Eq("exit status 3")
+
+	verify.That(t, logger.records).Length().Eq(2)
+	verify.That(t, logger.records[0].level).Eq("debug")
+	verify.That(t, logger.records[0].msg).Eq("command started")
+	verify.That(t, logger.records[0].args).MapKeys().IsSupersetOf([]string{
+		"command", "args", "dir", "pid",
+	})
+	verify.That(t, logger.records[1].level).Eq("warn")
+	verify.That(t, logger.records[1].msg).Eq("command failed")
+	verify.That(t, logger.records[1].args["command"]).Eq("bash")
+	verify.That(t, logger.records[1].args["dir"]).Eq(tmp)
+	verify.That(t, logger.records[1].args["exit_code"]).Eq(3)
+	verify.That(t, logger.records[1].args["error"]).Eq("exit status 3")
+	verify.That(t, logger.records[1].args).MapKeys().IsSupersetOf([]string{"duration"})
+}
+
+// LogHooks
+// ---------------------------------------------------------------------------
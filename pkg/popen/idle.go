@@ -0,0 +1,60 @@
+package popen
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/maargenton/go-errors"
+)
+
+// ErrIdleTimeout is a sentinel error returned when a command is shut down
+// because it did not produce any output for longer than its `IdleTimeout`.
+var ErrIdleTimeout = errors.Sentinel("ErrIdleTimeout")
+
+// activityWriter is an io.Writer that records the time of the last write into
+// the execution before forwarding it to w, if not nil.
+type activityWriter struct {
+	e *execution
+	w io.Writer
+}
+
+func (a *activityWriter) Write(p []byte) (n int, err error) {
+	atomic.StoreInt64(&a.e.lastActivity, time.Now().UnixNano())
+	if a.w == nil {
+		return len(p), nil
+	}
+	return a.w.Write(p)
+}
+
+// watchIdle triggers the shutdown of the sub-process when none of its output
+// streams has produced any output for longer than the idle timeout of the
+// command. It returns once the execution context is done.
+func (e *execution) watchIdle() {
+	var timeout = e.c.IdleTimeout
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		var last = atomic.LoadInt64(&e.lastActivity)
+		var idle = time.Since(time.Unix(0, last))
+		if idle >= timeout {
+			atomic.StoreInt32(&e.idleTimedOut, 1)
+			e.cancel()
+			return
+		}
+		timer.Reset(timeout - idle)
+	}
+}
+
+// idleTimeout returns true if the execution has been shut down by its idle
+// output watchdog.
+func (e *execution) idleTimeout() bool {
+	return atomic.LoadInt32(&e.idleTimedOut) != 0
+}
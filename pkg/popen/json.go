@@ -0,0 +1,66 @@
+package popen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RunJSON executes the command as specified, like `Run()`, and decodes its
+// stdout output as a single JSON value into v. Anything but whitespace after
+// that value is an error. A decoding error aborts the command; the content of
+// stdout is otherwise not captured. `StdoutReader` and `DiscardStdout` are
+// overridden for that purpose and any value set by the caller is ignored.
+func (c *Command) RunJSON(ctx context.Context, v interface{}) error {
+	var decoded bool
+	var cmd = *c
+	cmd.DiscardStdout = true
+	cmd.StdoutReader = func(r io.Reader) error {
+		var decoder = json.NewDecoder(r)
+		err := decoder.Decode(v)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			if _, err = decoder.Token(); err == io.EOF {
+				decoded = true
+				return nil
+			} else if err == nil {
+				err = fmt.Errorf("unexpected content after JSON value")
+			}
+		}
+		return fmt.Errorf(
+			"failed to decode JSON output of command '%v': %w",
+			c.Command, err)
+	}
+
+	_, _, err := cmd.Run(ctx)
+	if err == nil && !decoded {
+		err = fmt.Errorf(
+			"failed to decode JSON output of command '%v': %w",
+			c.Command, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// jsonReader returns a reader function that decodes its input as a stream of
+// JSON records and passes them to handler.
+func jsonReader(handler func(record json.RawMessage) error) func(r io.Reader) error {
+	return func(r io.Reader) error {
+		var decoder = json.NewDecoder(r)
+		for i := 0; ; i++ {
+			var record json.RawMessage
+			err := decoder.Decode(&record)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to decode JSON record %v: %w", i, err)
+			}
+			if err := handler(record); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package popen_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+// ---------------------------------------------------------------------------
+// RunJSON
+
+func TestCommandRunJSON(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "echo",
+		Arguments: []string{`{"name": "foo", "values": [1, 2, 3]}`},
+	}
+
+	var v struct {
+		Name   string `json:"name"`
+		Values []int  `json:"values"`
+	}
+	err := cmd.RunJSON(context.Background(), &v)
+	verify.That(t, err).IsNil()
+	verify.That(t, v.Name).Eq("foo")
+	verify.That(t, v.Values).Eq([]int{1, 2, 3})
+}
+
+func TestCommandRunJSONInvalidOutput(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "echo not json; sleep 3"},
+	}
+
+	var v interface{}
+	var start = time.Now()
+	err := cmd.RunJSON(context.Background(), &v)
+	verify.That(t, err).ToString().Contains("failed to decode JSON output of command 'bash'")
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
+
+func TestCommandRunJSONTrailingContent(t *testing.T) {
+	for _, output := range []string{`{"a":1} garbage`, `{"a":1} {"b":2}`} {
+		var cmd = popen.Command{
+			Command:   "echo",
+			Arguments: []string{output},
+		}
+
+		var v interface{}
+		err := cmd.RunJSON(context.Background(), &v)
+		verify.That(t, err).ToString().Contains("failed to decode JSON output of command 'echo'")
+	}
+}
+
+func TestCommandRunJSONEmptyOutput(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "true",
+	}
+
+	var v interface{}
+	err := cmd.RunJSON(context.Background(), &v)
+	verify.That(t, err).IsError(io.ErrUnexpectedEOF)
+}
+
+func TestCommandRunJSONCommandError(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "exit 3"},
+	}
+
+	var v interface{}
+	err := cmd.RunJSON(context.Background(), &v)
+	verify.That(t, err).ToString().Eq("exit status 3")
+}
+
+// RunJSON
+// ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// StdoutJSONHandler
+
+func TestCommandStdoutJSONHandler(t *testing.T) {
+	type record struct {
+		ID int `json:"id"`
+	}
+	var records []record
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{"-c",
+			`for i in 1 2 3; do echo "{\"id\": $i}"; done`},
+		StdoutJSONHandler: func(raw json.RawMessage) error {
+			var r record
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return err
+			}
+			records = append(records, r)
+			return nil
+		},
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, records).Eq([]record{{1}, {2}, {3}})
+	verify.That(t, stdout).Eq("{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n")
+}
+
+func TestCommandStdoutJSONHandlerDecodeError(t *testing.T) {
+	var count int
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", `echo '{"id": 1}'; echo '{"id": '; echo garbage; sleep 3`},
+		StdoutJSONHandler: func(raw json.RawMessage) error {
+			count++
+			return nil
+		},
+	}
+
+	var start = time.Now()
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).ToString().StartsWith("failed to decode JSON record 1:")
+	verify.That(t, count).Eq(1)
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
+
+func TestCommandStdoutJSONHandlerError(t *testing.T) {
+	var expectedError = errors.New("handler error")
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", `echo '{"id": 1}'; sleep 3`},
+		StdoutJSONHandler: func(raw json.RawMessage) error {
+			return expectedError
+		},
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(expectedError)
+}
+
+// StdoutJSONHandler
+// ---------------------------------------------------------------------------
@@ -0,0 +1,81 @@
+package popen
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// DefaultMaxLineLength is the maximum length of the lines passed to line
+// handlers when `MaxLineLength` is not specified.
+const DefaultMaxLineLength = bufio.MaxScanTokenSize
+
+// lineReader returns a reader function that splits its input into lines and
+// passes them to handler, according to the line handling options of the
+// command.
+func (c *Command) lineReader(handler func(line string) error) func(r io.Reader) error {
+	var maxLineLength = c.MaxLineLength
+	if maxLineLength <= 0 {
+		maxLineLength = DefaultMaxLineLength
+	}
+	var discardUnterminatedLine = c.DiscardUnterminatedLine
+
+	return func(r io.Reader) error {
+		var br = bufio.NewReader(r)
+		var line []byte
+
+		// split is set once part of the current line has been passed to
+		// handler, in which case the line is not passed again if nothing is
+		// left of it.
+		var split bool
+		var handleLongLine = func() error {
+			for len(line) > maxLineLength {
+				if err := handler(string(line[:maxLineLength])); err != nil {
+					return err
+				}
+				line = line[maxLineLength:]
+				split = true
+			}
+			return nil
+		}
+
+		for {
+			chunk, err := br.ReadSlice('\n')
+			line = append(line, chunk...)
+
+			switch err {
+			case nil:
+				line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+				if err := handleLongLine(); err != nil {
+					return err
+				}
+				if len(line) > 0 || !split {
+					if err := handler(string(line)); err != nil {
+						return err
+					}
+				}
+				line, split = line[:0], false
+
+			case bufio.ErrBufferFull:
+				if err := handleLongLine(); err != nil {
+					return err
+				}
+
+			case io.EOF:
+				if discardUnterminatedLine {
+					return nil
+				}
+				if err := handleLongLine(); err != nil {
+					return err
+				}
+				if len(line) == 0 {
+					return nil
+				}
+				return handler(string(line))
+
+			default:
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package popen
+
+import (
+	"os"
+	"strings"
+
+	"github.com/maargenton/go-errors"
+
+	"github.com/maargenton/go-fileutils"
+)
+
+// ErrExecutableNotFound is a sentinel error returned when the executable of a
+// command cannot be found in any of the directories of the search path.
+var ErrExecutableNotFound = errors.Sentinel("ErrExecutableNotFound")
+
+// LookPath searches for an executable named name in the directories of path,
+// a list separated by `os.PathListSeparator`, or in the PATH of the current
+// process if path is empty, and returns its location with `/` separators. If
+// name contains a path separator, it is checked directly, relative to the
+// current directory, without searching. Relative directories in path are
+// ignored. If the executable is not found, the returned error matches
+// `ErrExecutableNotFound` and lists every directory searched.
+func LookPath(name, path string) (string, error) {
+	if path == "" {
+		path = os.Getenv("PATH")
+	}
+	p, _, err := lookPath([]string{name}, "", path)
+	if err != nil {
+		return "", err
+	}
+	return fileutils.ToSlash(p), nil
+}
+
+// lookPath searches for the first of names found as an executable, either in
+// the directories of path if the name is a simple name, or relative to dir if
+// it contains a path separator, and returns its native path along with the
+// matching name.
+func lookPath(names []string, dir, path string) (string, string, error) {
+	var searched []string
+	var dirs = strings.Split(path, string(os.PathListSeparator))
+
+	for _, name := range names {
+		if strings.ContainsAny(name, `/\`) {
+			var p = name
+			if dir != "" && !fileutils.IsAbs(name) {
+				p = fileutils.Join(dir, name)
+			}
+			if p, ok := findExecutable(fileutils.ToNative(p)); ok {
+				return p, name, nil
+			}
+			searched = append(searched, fileutils.Dir(p))
+			continue
+		}
+
+		for _, d := range dirs {
+			if d == "" || !fileutils.IsAbs(d) {
+				continue
+			}
+			if p, ok := findExecutable(fileutils.ToNative(fileutils.Join(d, name))); ok {
+				return p, name, nil
+			}
+			searched = append(searched, d)
+		}
+	}
+
+	return "", "", ErrExecutableNotFound.Errorf(
+		"executable file not found: '%v', searched in: %v",
+		strings.Join(names, "' or '"), strings.Join(uniqueStrings(searched), ", "))
+}
+
+// lookPath resolves the executable of the command, according to its search
+// options, in its effective environment env, and returns its path along with
+// the name it was found under, either `Command` or one of `FallbackCommands`.
+func (c *Command) lookPath(env []string) (path, name string, err error) {
+	path = c.SearchPath
+	if path == "" {
+		var ok bool
+		if env != nil {
+			path, ok = parseEnvList(env).lookup("PATH")
+		}
+		if !ok {
+			path = os.Getenv("PATH")
+		}
+	}
+	var names = append([]string{c.Command}, c.FallbackCommands...)
+	return lookPath(names, c.Directory, path)
+}
+
+func uniqueStrings(list []string) []string {
+	var seen = make(map[string]bool, len(list))
+	var result = make([]string, 0, len(list))
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package popen
+
+import "os"
+
+// findExecutable returns path if it is an executable regular file.
+func findExecutable(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return "", false
+	}
+	return path, true
+}
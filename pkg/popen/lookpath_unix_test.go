@@ -0,0 +1,120 @@
+//go:build !windows
+// +build !windows
+
+package popen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func writeScript(t *testing.T, filename, content string) {
+	os.MkdirAll(fileutils.Dir(filename), 0777)
+	err := ioutil.WriteFile(filename, []byte("#!/bin/sh\n"+content+"\n"), 0755)
+	if err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	var tmp = tempDir(t)
+	var a, b = fileutils.Join(tmp, "a"), fileutils.Join(tmp, "b")
+	writeScript(t, fileutils.Join(b, "foo"), "echo foo")
+	ioutil.WriteFile(fileutils.Join(a, "foo"), []byte("not executable"), 0644)
+
+	path, err := popen.LookPath("foo", a+":"+b)
+	verify.That(t, err).IsNil()
+	verify.That(t, path).Eq(fileutils.Join(b, "foo"))
+
+	path, err = popen.LookPath("sh", "")
+	verify.That(t, err).IsNil()
+	verify.That(t, path).EndsWith("/sh")
+}
+
+func TestLookPathNotFound(t *testing.T) {
+	var tmp = tempDir(t)
+	var a, b = fileutils.Join(tmp, "a"), fileutils.Join(tmp, "b")
+
+	_, err := popen.LookPath("foo", a+":relative:"+b)
+	verify.That(t, err).IsError(popen.ErrExecutableNotFound)
+	verify.That(t, err).ToString().Contains(
+		"executable file not found: 'foo', searched in: " + a + ", " + b)
+}
+
+func TestCommandSearchPath(t *testing.T) {
+	var tmp = tempDir(t)
+	writeScript(t, fileutils.Join(tmp, "bin", "foo"), "echo foo")
+
+	var cmd = popen.Command{
+		Command:    "foo",
+		SearchPath: fileutils.Join(tmp, "bin"),
+	}
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("foo\n")
+}
+
+func TestCommandSearchPathFromEnv(t *testing.T) {
+	var tmp = tempDir(t)
+	writeScript(t, fileutils.Join(tmp, "bin", "foo"), "echo foo")
+
+	var cmd = popen.Command{
+		Command: "foo",
+		Env:     []string{"PATH=" + fileutils.Join(tmp, "bin") + ":" + os.Getenv("PATH")},
+	}
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("foo\n")
+}
+
+func TestCommandFallbackCommands(t *testing.T) {
+	var tmp = tempDir(t)
+	writeScript(t, fileutils.Join(tmp, "bin", "bar"), "echo bar $1")
+	writeScript(t, fileutils.Join(tmp, "local", "baz"), "echo baz $1")
+
+	var cmd = popen.Command{
+		Command:          "foo",
+		FallbackCommands: []string{"./local/baz", "bar"},
+		Arguments:        []string{"arg"},
+		Directory:        tmp,
+		SearchPath:       fileutils.Join(tmp, "bin"),
+	}
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("baz arg\n")
+
+	cmd.FallbackCommands = []string{"./local/qux", "bar"}
+	stdout, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("bar arg\n")
+
+	cmd.FallbackCommands = []string{"./local/qux"}
+	_, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsError(popen.ErrExecutableNotFound)
+	verify.That(t, err).ToString().Contains(
+		"executable file not found: 'foo' or './local/qux', searched in: " +
+			fileutils.Join(tmp, "bin") + ", " + fileutils.Join(tmp, "local"))
+}
+
+func TestCommandArgv0(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "sh",
+		Arguments: []string{"-c", "echo $0"},
+	}
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("sh\n")
+
+	cmd.Command = "not-a-command"
+	cmd.FallbackCommands = []string{"sh"}
+	stdout, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("sh\n")
+}
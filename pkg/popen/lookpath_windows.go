@@ -0,0 +1,45 @@
+//go:build windows
+// +build windows
+
+package popen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findExecutable returns path, or path with the first of the extensions listed
+// in PATHEXT that results in an existing regular file, unless path already
+// has one of those extensions.
+func findExecutable(path string) (string, bool) {
+	var exts = []string{".com", ".exe", ".bat", ".cmd"}
+	if pathext := os.Getenv("PATHEXT"); pathext != "" {
+		exts = strings.Split(strings.ToLower(pathext), ";")
+	}
+
+	var candidates = []string{path}
+	var ext = strings.ToLower(filepath.Ext(path))
+	if ext == "" || !contains(exts, ext) {
+		candidates = candidates[:0]
+		for _, ext := range exts {
+			candidates = append(candidates, path+ext)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
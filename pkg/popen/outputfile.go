@@ -0,0 +1,103 @@
+package popen
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/maargenton/go-fileutils"
+)
+
+// OutputFileMode defines how the output file of a command, as specified by
+// `WriteStdoutToFile` or `WriteStderrToFile`, is written.
+type OutputFileMode int
+
+const (
+	// TruncateFile causes the output file to be created or truncated before
+	// the command starts. This is the default mode.
+	TruncateFile OutputFileMode = iota
+
+	// AppendFile causes the output of the command to be appended to the
+	// output file, which is created if it does not exist.
+	AppendFile
+
+	// AtomicFile causes the output of the command to be written into a
+	// temporary file in the same directory, which atomically replaces the
+	// output file only if the command succeeds, like `fileutils.WriteFile()`.
+	// The temporary file is removed if the command fails.
+	AtomicFile
+)
+
+// openOutputFile opens the specified output file of the command according to
+// mode, registering it to be closed after the command exits and, in atomic
+// mode, to be renamed into place if the command succeeds.
+func (e *execution) openOutputFile(stream, filename string, mode OutputFileMode) (*os.File, error) {
+	if e.c.CreateOutputDirs {
+		if err := os.MkdirAll(fileutils.Dir(filename), 0777); err != nil {
+			return nil, fmt.Errorf(
+				"failed to create %v file directory '%v': %w",
+				stream, filename, err)
+		}
+	}
+
+	var f *os.File
+	var err error
+	switch mode {
+	case AppendFile:
+		f, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	case AtomicFile:
+		f, err = fileutils.OpenTemp(filename, "atomic")
+	default:
+		f, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to open %v file '%v': %w",
+			stream, filename, err)
+	}
+	if mode != AtomicFile {
+		e.closeAfterWait = append(e.closeAfterWait, f)
+		return f, nil
+	}
+
+	// In atomic mode, the file remains open until the command completes, to
+	// flush its content to disk before renaming it into place
+	e.inv.keepOpen(f)
+	e.finalizers = append(e.finalizers, func(err error) error {
+		if err == nil {
+			err = commitFile(f, filename)
+		} else {
+			f.Close()
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+		return err
+	})
+	return f, nil
+}
+
+// commitFile flushes the content of the temporary file f to disk, closes it
+// and renames it into filename.
+func commitFile(f *os.File, filename string) error {
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output file '%v': %w", filename, err)
+	}
+	return nil
+}
+
+// finalize runs the finalizers of the execution, passing them the outcome of
+// the execution, and returns the first error, if any.
+func (e *execution) finalize(err error) error {
+	for _, finalizer := range e.finalizers {
+		err = finalizer(err)
+	}
+	e.finalizers = nil
+	return err
+}
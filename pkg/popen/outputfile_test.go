@@ -0,0 +1,119 @@
+package popen_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func readFile(t *testing.T, filename string) string {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	return string(content)
+}
+
+func listDir(t *testing.T, dirname string) (names []string) {
+	entries, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return
+}
+
+func TestCommandOutputFileAppend(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "output.log")
+	var cmd = popen.Command{
+		Command:           "bash",
+		Arguments:         []string{"-c", "echo out; echo err >&2"},
+		WriteStdoutToFile: filename,
+		StdoutFileMode:    popen.AppendFile,
+		WriteStderrToFile: filename,
+		StderrFileMode:    popen.AppendFile,
+	}
+
+	for i := 0; i < 2; i++ {
+		_, _, err := cmd.Run(context.Background())
+		verify.That(t, err).IsNil()
+	}
+	verify.That(t, readFile(t, filename)).Eq("out\nerr\nout\nerr\n")
+}
+
+func TestCommandOutputFileAtomic(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "output.txt")
+	ioutil.WriteFile(filename, []byte("previous\n"), 0644)
+
+	var cmd = popen.Command{
+		Command:           "echo",
+		Arguments:         []string{"Hello World"},
+		WriteStdoutToFile: filename,
+		StdoutFileMode:    popen.AtomicFile,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, readFile(t, filename)).Eq("Hello World\n")
+	verify.That(t, listDir(t, tmp)).Eq([]string{"output.txt"})
+}
+
+func TestCommandOutputFileAtomicFailure(t *testing.T) {
+	var tmp = tempDir(t)
+	var filename = fileutils.Join(tmp, "output.txt")
+	ioutil.WriteFile(filename, []byte("previous\n"), 0644)
+
+	var cmd = popen.Command{
+		Command:           "bash",
+		Arguments:         []string{"-c", "echo partial; exit 1"},
+		WriteStdoutToFile: filename,
+		StdoutFileMode:    popen.AtomicFile,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).ToString().Eq("exit status 1")
+	verify.That(t, readFile(t, filename)).Eq("previous\n")
+	verify.That(t, listDir(t, tmp)).Eq([]string{"output.txt"})
+}
+
+func TestCommandOutputFileAtomicStartFailure(t *testing.T) {
+	var tmp = tempDir(t)
+	var cmd = popen.Command{
+		Command:           "./does-not-exist",
+		WriteStdoutToFile: fileutils.Join(tmp, "output.txt"),
+		StdoutFileMode:    popen.AtomicFile,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNotNil()
+	verify.That(t, listDir(t, tmp)).IsEmpty()
+}
+
+func TestCommandOutputFileCreateDirs(t *testing.T) {
+	var tmp = tempDir(t)
+	var stdoutFile = fileutils.Join(tmp, "a", "b", "stdout.txt")
+	var stderrFile = fileutils.Join(tmp, "c", "stderr.txt")
+	var cmd = popen.Command{
+		Command:           "bash",
+		Arguments:         []string{"-c", "echo out; echo err >&2"},
+		WriteStdoutToFile: stdoutFile,
+		StdoutFileMode:    popen.AtomicFile,
+		WriteStderrToFile: stderrFile,
+		CreateOutputDirs:  true,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, readFile(t, stdoutFile)).Eq("out\n")
+	verify.That(t, readFile(t, stderrFile)).Eq("err\n")
+
+	cmd.CreateOutputDirs = false
+	cmd.WriteStdoutToFile = fileutils.Join(tmp, "d", "stdout.txt")
+	_, _, err = cmd.Run(context.Background())
+	verify.That(t, err).ToString().StartsWith("failed to open stdout file")
+}
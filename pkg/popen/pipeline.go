@@ -0,0 +1,151 @@
+package popen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Pipeline chains multiple commands, connecting the stdout stream of each
+// command to the stdin input of the next one, similar to `cmd1 | cmd2 | cmd3`
+// in a shell, but without any shell expansion of the arguments.
+//
+// The stdin options of the first command are used to feed the pipeline, and
+// the stdout options of the last command define what happens with the output
+// of the pipeline; the stdin options of all other commands and the stdout
+// options of all but the last command are ignored. The stderr options and the
+// shutdown options of each command apply individually to that command.
+type Pipeline struct {
+	// Commands is the ordered list of commands that constitute the pipeline.
+	Commands []Command
+}
+
+// PipelineError is the error returned when one or more commands of a pipeline
+// fail. Following the `pipefail` semantic of common shells, a pipeline fails if
+// any of its commands fails, and the reported command is the last (rightmost)
+// one that failed.
+type PipelineError struct {
+	// Stage is the index in the pipeline of the last command that failed.
+	Stage int
+
+	// Command is the name of the last command that failed.
+	Command string
+
+	// Errors contains the errors returned by each command of the pipeline, in
+	// order, with nil entries for the commands that succeeded.
+	Errors []error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf(
+		"pipeline stage %v '%v' failed: %v",
+		e.Stage, e.Command, e.Errors[e.Stage])
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Errors[e.Stage]
+}
+
+// ExitCodes returns the exit status of each command of the pipeline, in order.
+// The exit status is 0 for commands that succeeded, and -1 for commands that
+// were terminated by a signal or failed for a reason other than a non-zero exit
+// status.
+func (e *PipelineError) ExitCodes() []int {
+	var codes = make([]int, len(e.Errors))
+	for i, err := range e.Errors {
+		var exitErr exitCoder
+		if err == nil {
+			codes[i] = 0
+		} else if errors.As(err, &exitErr) {
+			codes[i] = exitErr.ExitCode()
+		} else {
+			codes[i] = -1
+		}
+	}
+	return codes
+}
+
+// Run executes all the commands of the pipeline concurrently and returns the
+// captured content of the stdout of the last command and the concatenated
+// captured content of the stderr of all the commands, in pipeline order. If
+// any command fails, the returned error is a *PipelineError that identifies
+// the failing command and carries the result of every command.
+func (p *Pipeline) Run(ctx context.Context) (stdout, stderr string, err error) {
+	if len(p.Commands) == 0 {
+		return "", "", fmt.Errorf("failed to run empty pipeline")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var executions []*execution
+	var stdin *os.File
+	for i := range p.Commands {
+		var next, w *os.File
+		if i < len(p.Commands)-1 {
+			next, w, err = os.Pipe()
+			if err != nil {
+				err = fmt.Errorf("failed to create pipe: %w", err)
+			}
+		}
+
+		// The pipe ends are closed by each execution once no longer needed
+		var e *execution
+		if err == nil {
+			e, err = p.Commands[i].prepare(ctx, stdin, w)
+		} else if stdin != nil {
+			stdin.Close()
+		}
+		if err == nil {
+			err = e.start()
+		}
+		stdin = next
+
+		if err != nil {
+			if stdin != nil {
+				stdin.Close()
+			}
+			cancel()
+			for _, e := range executions {
+				e.wait()
+			}
+			return "", "", err
+		}
+		executions = append(executions, e)
+	}
+
+	var stdouts = make([]string, len(executions))
+	var stderrs = make([]string, len(executions))
+	var errs = make([]error, len(executions))
+	var wg sync.WaitGroup
+	for i, e := range executions {
+		wg.Add(1)
+		go func(i int, e *execution) {
+			defer wg.Done()
+			var result *Result
+			result, errs[i] = e.wait()
+			stdouts[i], stderrs[i] = result.Stdout, result.Stderr
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i := len(errs) - 1; i >= 0; i-- {
+		if errs[i] != nil {
+			err = &PipelineError{
+				Stage:   i,
+				Command: p.Commands[i].Command,
+				Errors:  errs,
+			}
+			break
+		}
+	}
+
+	stdout = stdouts[len(stdouts)-1]
+	stderr = strings.Join(stderrs, "")
+	return
+}
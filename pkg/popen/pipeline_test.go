@@ -0,0 +1,116 @@
+package popen_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestPipeline(t *testing.T) {
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{Command: "cat", Stdin: "foo\nbar\nbaz\n"},
+			{Command: "grep", Arguments: []string{"ba"}},
+			{Command: "sort", Arguments: []string{"-r"}},
+		},
+	}
+
+	stdout, _, err := p.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("baz\nbar\n")
+}
+
+func TestPipelineLastCommandOutputOptions(t *testing.T) {
+	var buf strings.Builder
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{
+				Command:      "echo",
+				Arguments:    []string{"Hello World"},
+				StdoutReader: func(r io.Reader) error { return errors.New("ignored") },
+			},
+			{
+				Command: "cat",
+				Stdin:   "ignored",
+				StdoutReader: func(r io.Reader) error {
+					_, err := io.Copy(&buf, r)
+					return err
+				},
+				DiscardStdout: true,
+			},
+		},
+	}
+
+	stdout, _, err := p.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("")
+	verify.That(t, buf.String()).Eq("Hello World\n")
+}
+
+func TestPipelineStderr(t *testing.T) {
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{Command: "bash", Arguments: []string{"-c", "echo foo 1>&2"}},
+			{Command: "bash", Arguments: []string{"-c", "cat; echo bar 1>&2"}},
+		},
+	}
+
+	_, stderr, err := p.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stderr).Eq("foo\nbar\n")
+}
+
+func TestPipelineFailure(t *testing.T) {
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{Command: "bash", Arguments: []string{"-c", "exit 2"}},
+			{Command: "bash", Arguments: []string{"-c", "cat; exit 3"}},
+			{Command: "cat"},
+		},
+	}
+
+	_, _, err := p.Run(context.Background())
+	var pipelineErr *popen.PipelineError
+	verify.That(t, errors.As(err, &pipelineErr)).IsTrue()
+	verify.That(t, pipelineErr.Stage).Eq(1)
+	verify.That(t, pipelineErr.Command).Eq("bash")
+	verify.That(t, pipelineErr.ExitCodes()).Eq([]int{2, 3, 0})
+	verify.That(t, err).ToString().Eq("pipeline stage 1 'bash' failed: exit status 3")
+}
+
+func TestPipelineWithInvalidCommand(t *testing.T) {
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{Command: "sleep", Arguments: []string{"10"}},
+			{Command: "__invalid__command__"},
+		},
+	}
+
+	var start = time.Now()
+	_, _, err := p.Run(context.Background())
+	verify.That(t, err).ToString().Contains("executable file not found")
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+}
+
+func TestPipelineContextCancellation(t *testing.T) {
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{Command: "sleep", Arguments: []string{"10"}},
+			{Command: "sleep", Arguments: []string{"10"}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	_, _, err := p.Run(ctx)
+	verify.That(t, err).IsNotNil()
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+}
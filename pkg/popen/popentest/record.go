@@ -0,0 +1,317 @@
+package popentest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/maargenton/go-errors"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+// ErrReplayMismatch is a sentinel error returned when a replayed command does
+// not match any of the recorded invocations.
+var ErrReplayMismatch = errors.Sentinel("ErrReplayMismatch")
+
+// Record captures a single invocation of a command and its outcome, as saved
+// into a golden file by a Recorder and served back by a Replayer.
+type Record struct {
+	Command      string   `json:"command"`
+	Arguments    []string `json:"arguments,omitempty"`
+	Directory    string   `json:"directory,omitempty"`
+	Env          []string `json:"env,omitempty"`
+	UnsetEnv     []string `json:"unset_env,omitempty"`
+	OverwriteEnv bool     `json:"overwrite_env,omitempty"`
+	Stdin        string   `json:"stdin,omitempty"`
+	Stdout       string   `json:"stdout,omitempty"`
+	Stderr       string   `json:"stderr,omitempty"`
+	ExitCode     int      `json:"exit_code"`
+}
+
+func newRecord(c *popen.Command) Record {
+	var r = Record{
+		Command:      c.Command,
+		Directory:    c.Directory,
+		OverwriteEnv: c.OverwriteEnv,
+	}
+	// Keep empty lists nil, as they are when loaded from a golden file
+	if len(c.Arguments) > 0 {
+		r.Arguments = c.Arguments
+	}
+	var set, unset = c.EnvChanges()
+	if len(set) > 0 {
+		r.Env = set
+	}
+	if len(unset) > 0 {
+		r.UnsetEnv = unset
+	}
+	return r
+}
+
+// ---------------------------------------------------------------------------
+// Recorder
+
+// Recorder is an implementation of `popen.Runner` that executes commands
+// through another runner and records every invocation, including its inputs
+// and outputs, to be saved into a golden file. The environment is recorded as
+// the changes made by the command to the environment of the current process,
+// as returned by `Command.EnvChanges()`, i.e. in full only if `OverwriteEnv` is
+// set.
+type Recorder struct {
+	// Runner is the runner used to actually execute the commands. If not
+	// specified, `popen.ExecRunner` is used.
+	Runner popen.Runner
+
+	mutex   sync.Mutex
+	records []*Record
+}
+
+var _ popen.Runner = &Recorder{}
+
+// Start implements popen.Runner and starts the execution of the command
+// described by inv, capturing its inputs and outputs.
+func (r *Recorder) Start(inv *popen.Invocation) (popen.Handle, error) {
+	var runner = r.Runner
+	if runner == nil {
+		runner = popen.ExecRunner{}
+	}
+
+	var h = &recorderHandle{
+		r:      r,
+		inv:    inv,
+		record: newRecord(inv.Command),
+	}
+	var recorded = *inv
+	if inv.Stdin != nil {
+		recorded.Stdin = io.TeeReader(inv.Stdin, &h.stdin)
+	}
+	recorded.Stdout = teeWriter(inv.Stdout, &h.stdout)
+	recorded.Stderr = teeWriter(inv.Stderr, &h.stderr)
+
+	handle, err := runner.Start(&recorded)
+	if err != nil {
+		inv.CloseFiles()
+		return nil, err
+	}
+	h.handle = handle
+
+	r.mutex.Lock()
+	r.records = append(r.records, &h.record)
+	r.mutex.Unlock()
+	return h, nil
+}
+
+// Records returns a copy of all the records captured so far, in the order the
+// commands were started.
+func (r *Recorder) Records() []Record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var records = make([]Record, 0, len(r.records))
+	for _, record := range r.records {
+		records = append(records, *record)
+	}
+	return records
+}
+
+// Save atomically writes all the records captured so far into the specified
+// golden file.
+func (r *Recorder) Save(filename string) error {
+	var records = r.Records()
+	return fileutils.WriteFile(filename, func(w io.Writer) error {
+		var encoder = json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	})
+}
+
+type recorderHandle struct {
+	r      *Recorder
+	inv    *popen.Invocation
+	handle popen.Handle
+	record Record
+
+	stdin  strings.Builder
+	stdout strings.Builder
+	stderr strings.Builder
+}
+
+func (h *recorderHandle) Pid() int {
+	return h.handle.Pid()
+}
+
+func (h *recorderHandle) Signal(signal syscall.Signal) error {
+	return h.handle.Signal(signal)
+}
+
+func (h *recorderHandle) Wait(result *popen.Result) error {
+	var err = h.handle.Wait(result)
+	h.inv.CloseFiles()
+
+	h.r.mutex.Lock()
+	defer h.r.mutex.Unlock()
+	h.record.Stdin = h.stdin.String()
+	h.record.Stdout = h.stdout.String()
+	h.record.Stderr = h.stderr.String()
+	h.record.ExitCode = result.ExitCode
+	return err
+}
+
+func teeWriter(w io.Writer, capture io.Writer) io.Writer {
+	if w == nil {
+		return capture
+	}
+	return io.MultiWriter(w, capture)
+}
+
+// Recorder
+// ---------------------------------------------------------------------------
+
+// ---------------------------------------------------------------------------
+// Replayer
+
+// Replayer is an implementation of `popen.Runner` that serves the outcome of
+// previously recorded invocations without spawning any process. Each recorded
+// invocation is served once, to the first command that matches it exactly;
+// commands that do not match any remaining record fail with an error that
+// details the differences with the closest record.
+type Replayer struct {
+	mutex   sync.Mutex
+	records []Record
+	used    []bool
+}
+
+var _ popen.Runner = &Replayer{}
+
+// NewReplayer returns a Replayer serving the specified records.
+func NewReplayer(records []Record) *Replayer {
+	return &Replayer{
+		records: records,
+		used:    make([]bool, len(records)),
+	}
+}
+
+// LoadReplayer returns a Replayer serving the records loaded from the
+// specified golden file, previously saved by a Recorder.
+func LoadReplayer(filename string) (*Replayer, error) {
+	var records []Record
+	err := fileutils.ReadFile(filename, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&records)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load records from '%v': %w", filename, err)
+	}
+	return NewReplayer(records), nil
+}
+
+// Remaining returns the records that have not been replayed yet.
+func (r *Replayer) Remaining() []Record {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var records []Record
+	for i, record := range r.records {
+		if !r.used[i] {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Start implements popen.Runner and starts the replay of the first remaining
+// record matching the command described by inv.
+func (r *Replayer) Start(inv *popen.Invocation) (popen.Handle, error) {
+	var actual = newRecord(inv.Command)
+
+	r.mutex.Lock()
+	var match, closest = -1, -1
+	for i, record := range r.records {
+		if r.used[i] {
+			continue
+		}
+		if closest < 0 || record.Command == actual.Command &&
+			r.records[closest].Command != actual.Command {
+			closest = i
+		}
+		if diffRecords(record, actual, false) == "" {
+			match = i
+			break
+		}
+	}
+	if match >= 0 {
+		r.used[match] = true
+	}
+	r.mutex.Unlock()
+
+	if match < 0 {
+		inv.CloseFiles()
+		if closest < 0 {
+			return nil, ErrReplayMismatch.Errorf(
+				"no remaining record for command: %v", inv.Command)
+		}
+		return nil, ErrReplayMismatch.Errorf(
+			"no matching record for command (-recorded +actual):\n%v",
+			diffRecords(r.records[closest], actual, false))
+	}
+
+	var expected = r.records[match]
+	var response = Response{
+		Stdout:   expected.Stdout,
+		Stderr:   expected.Stderr,
+		ExitCode: expected.ExitCode,
+	}
+	return startHandle(inv, response, func(stdin string) error {
+		actual.Stdin = stdin
+		if diff := diffRecords(expected, actual, true); diff != "" {
+			return ErrReplayMismatch.Errorf(
+				"stdin does not match record (-recorded +actual):\n%v", diff)
+		}
+		return nil
+	}), nil
+}
+
+// diffRecords compares the invocation fields of two records and returns a
+// line-by-line diff of those fields if they differ, or an empty string. The
+// stdin field is compared only if withStdin is true.
+func diffRecords(expected, actual Record, withStdin bool) string {
+	var fields = []struct {
+		name             string
+		expected, actual interface{}
+	}{
+		{"command", expected.Command, actual.Command},
+		{"arguments", expected.Arguments, actual.Arguments},
+		{"directory", expected.Directory, actual.Directory},
+		{"env", expected.Env, actual.Env},
+		{"unset_env", expected.UnsetEnv, actual.UnsetEnv},
+		{"overwrite_env", expected.OverwriteEnv, actual.OverwriteEnv},
+	}
+	if withStdin {
+		fields = append(fields, struct {
+			name             string
+			expected, actual interface{}
+		}{"stdin", expected.Stdin, actual.Stdin})
+	}
+
+	var diff strings.Builder
+	var differ bool
+	for _, f := range fields {
+		e, _ := json.Marshal(f.expected)
+		a, _ := json.Marshal(f.actual)
+		if string(e) == string(a) {
+			fmt.Fprintf(&diff, "  %v: %s\n", f.name, e)
+		} else {
+			differ = true
+			fmt.Fprintf(&diff, "- %v: %s\n+ %v: %s\n", f.name, e, f.name, a)
+		}
+	}
+	if !differ {
+		return ""
+	}
+	return diff.String()
+}
+
+// Replayer
+// ---------------------------------------------------------------------------
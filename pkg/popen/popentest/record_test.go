@@ -0,0 +1,125 @@
+package popentest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+	"github.com/maargenton/go-fileutils/pkg/popen/popentest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var tmp, _ = ioutil.TempDir("", "popentest-")
+	defer os.RemoveAll(tmp)
+	var golden = tmp + "/golden.json"
+
+	var commands = []popen.Command{
+		{Command: "cat", Stdin: "Hello World\n"},
+		{Command: "bash", Arguments: []string{"-c", "echo foo; echo bar 1>&2; exit 3"}},
+		{Command: "env", Env: []string{"FOO=bar"}, OverwriteEnv: true},
+	}
+
+	// Record
+	var recorder popentest.Recorder
+	var recorded []*popen.Result
+	for _, cmd := range commands {
+		cmd.Runner = &recorder
+		result, _ := cmd.RunResult(context.Background())
+		recorded = append(recorded, result)
+	}
+	verify.That(t, recorder.Save(golden)).IsNil()
+
+	var records = recorder.Records()
+	verify.That(t, records).Length().Eq(3)
+	verify.That(t, records[0].Stdin).Eq("Hello World\n")
+	verify.That(t, records[0].Stdout).Eq("Hello World\n")
+	verify.That(t, records[1].Stderr).Eq("bar\n")
+	verify.That(t, records[1].ExitCode).Eq(3)
+	verify.That(t, records[2].Stdout).Eq("FOO=bar\n")
+
+	// Replay, in a different order
+	replayer, err := popentest.LoadReplayer(golden)
+	verify.That(t, err).IsNil()
+	for _, i := range []int{2, 0, 1} {
+		var cmd = commands[i]
+		cmd.Runner = replayer
+		result, _ := cmd.RunResult(context.Background())
+		verify.That(t, result.Stdout).Eq(recorded[i].Stdout)
+		verify.That(t, result.Stderr).Eq(recorded[i].Stderr)
+		verify.That(t, result.ExitCode).Eq(recorded[i].ExitCode)
+	}
+	verify.That(t, replayer.Remaining()).IsEmpty()
+}
+
+func TestReplayMismatch(t *testing.T) {
+	var replayer = popentest.NewReplayer([]popentest.Record{
+		{Command: "ls", Stdout: "foo\n"},
+		{Command: "git", Arguments: []string{"status"}, Stdout: "clean\n"},
+	})
+
+	var cmd = popen.Command{
+		Command:   "git",
+		Arguments: []string{"status", "-s"},
+		Runner:    replayer,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(popentest.ErrReplayMismatch)
+	verify.That(t, err).ToString().Contains(
+		"  command: \"git\"\n" +
+			"- arguments: [\"status\"]\n" +
+			"+ arguments: [\"status\",\"-s\"]\n")
+	verify.That(t, replayer.Remaining()).Length().Eq(2)
+}
+
+func TestReplayEnvironmentMismatch(t *testing.T) {
+	var replayer = popentest.NewReplayer([]popentest.Record{
+		{Command: "env", Stdout: "FOO=bar\n"},
+	})
+
+	var env popen.Environment
+	env.Unset("HOME")
+	var cmd = popen.Command{
+		Command:     "env",
+		Environment: &env,
+		Runner:      replayer,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(popentest.ErrReplayMismatch)
+	verify.That(t, err).ToString().Contains(
+		"- unset_env: null\n" +
+			"+ unset_env: [\"HOME\"]\n")
+}
+
+func TestReplayStdinMismatch(t *testing.T) {
+	var replayer = popentest.NewReplayer([]popentest.Record{
+		{Command: "cat", Stdin: "foo\n", Stdout: "foo\n"},
+	})
+
+	var cmd = popen.Command{
+		Command: "cat",
+		Stdin:   "bar\n",
+		Runner:  replayer,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(popentest.ErrReplayMismatch)
+	verify.That(t, err).ToString().Contains("- stdin: \"foo\\n\"\n+ stdin: \"bar\\n\"\n")
+}
+
+func TestReplayExhausted(t *testing.T) {
+	var replayer = popentest.NewReplayer([]popentest.Record{
+		{Command: "ls"},
+	})
+
+	var cmd = popen.Command{
+		Command: "ls",
+		Runner:  replayer,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	_, _, err = cmd.Run(context.Background())
+	verify.That(t, err).IsError(popentest.ErrReplayMismatch)
+}
@@ -0,0 +1,289 @@
+// Package popentest provides a scriptable fake implementation of
+// `popen.Runner`, to unit test code that executes commands through
+// `popen.Command` without spawning any actual process.
+//
+// The fake runner only replaces the execution of the process itself; all the
+// input and output options of the commands, like `StdinWriter`,
+// `StdoutReader`, line handlers or output files, behave exactly as they do
+// with actual processes.
+package popentest
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/maargenton/go-errors"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+// ErrUnexpectedCommand is a sentinel error returned when starting a command
+// that does not match any registered expectation.
+var ErrUnexpectedCommand = errors.Sentinel("ErrUnexpectedCommand")
+
+// Matcher is a predicate that selects the commands an expectation applies to.
+type Matcher func(c *popen.Command) bool
+
+// Command returns a Matcher that matches commands with the specified name and
+// the exact specified arguments.
+func Command(name string, args ...string) Matcher {
+	return func(c *popen.Command) bool {
+		return c.Command == name && len(c.Arguments) == len(args) &&
+			(len(args) == 0 || reflect.DeepEqual(c.Arguments, args))
+	}
+}
+
+// CommandPrefix returns a Matcher that matches commands with the specified name
+// whose arguments start with the specified arguments.
+func CommandPrefix(name string, args ...string) Matcher {
+	return func(c *popen.Command) bool {
+		return c.Command == name && len(c.Arguments) >= len(args) &&
+			(len(args) == 0 || reflect.DeepEqual(c.Arguments[:len(args)], args))
+	}
+}
+
+// Response describes the canned outcome of the commands matching an
+// expectation.
+type Response struct {
+	// Stdout is written to the stdout stream of the command.
+	Stdout string
+
+	// Stderr is written to the stderr stream of the command.
+	Stderr string
+
+	// ExitCode is the exit status of the command. A non-zero exit code is
+	// reported as an *ExitError.
+	ExitCode int
+
+	// Delay is the time the command takes to complete after writing its
+	// outputs. If the context becomes done during that time, the command is
+	// terminated as if it had been killed.
+	Delay time.Duration
+
+	// Err, if not nil, is returned as a failure to start the command.
+	Err error
+}
+
+// Call records a single invocation of a command through the fake runner.
+type Call struct {
+	// Command is a copy of the invoked command.
+	Command popen.Command
+
+	// Stdin is the content of the stdin input received by the command.
+	Stdin string
+
+	// Matched is true if the command matched a registered expectation.
+	Matched bool
+}
+
+// Runner is a fake implementation of `popen.Runner` that serves canned
+// responses to the commands matching registered expectations, and records
+// every invocation. The zero value is ready to use, and a Runner can be used
+// concurrently by multiple commands.
+type Runner struct {
+	mutex        sync.Mutex
+	expectations []expectation
+	calls        []*Call
+}
+
+type expectation struct {
+	match    Matcher
+	response Response
+}
+
+var _ popen.Runner = &Runner{}
+
+// Expect registers a canned response for the commands matching match.
+// Expectations are evaluated in registration order, and the first match wins.
+func (r *Runner) Expect(match Matcher, response Response) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.expectations = append(r.expectations, expectation{match, response})
+}
+
+// Calls returns a copy of the list of all the invocations recorded so far, in
+// order.
+func (r *Runner) Calls() []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var calls = make([]Call, 0, len(r.calls))
+	for _, call := range r.calls {
+		calls = append(calls, *call)
+	}
+	return calls
+}
+
+// Invoked returns the number of recorded invocations of commands matching
+// match.
+func (r *Runner) Invoked(match Matcher) (n int) {
+	for _, call := range r.Calls() {
+		var c = call.Command
+		if match(&c) {
+			n++
+		}
+	}
+	return
+}
+
+// Start implements popen.Runner and starts the fake execution of the command
+// described by inv.
+func (r *Runner) Start(inv *popen.Invocation) (popen.Handle, error) {
+	r.mutex.Lock()
+	var call = &Call{Command: *inv.Command}
+	r.calls = append(r.calls, call)
+	var response *Response
+	for _, e := range r.expectations {
+		if e.match(inv.Command) {
+			response = &e.response
+			break
+		}
+	}
+	call.Matched = response != nil
+	r.mutex.Unlock()
+
+	if response == nil {
+		inv.CloseFiles()
+		return nil, ErrUnexpectedCommand.Errorf("%v", inv.Command)
+	}
+	if response.Err != nil {
+		inv.CloseFiles()
+		return nil, response.Err
+	}
+
+	return startHandle(inv, *response, func(stdin string) error {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		call.Stdin = stdin
+		return nil
+	}), nil
+}
+
+// handle is a fake execution serving a canned response. Once the execution
+// completes, the content of stdin is passed to done, which can return an error
+// to fail the execution.
+type handle struct {
+	inv      *popen.Invocation
+	response Response
+	done     func(stdin string) error
+	signals  chan syscall.Signal
+
+	stdin     strings.Builder
+	stdinDone chan struct{}
+}
+
+func startHandle(inv *popen.Invocation, response Response, done func(stdin string) error) *handle {
+	var h = &handle{
+		inv:       inv,
+		response:  response,
+		done:      done,
+		signals:   make(chan syscall.Signal, 1),
+		stdinDone: make(chan struct{}),
+	}
+	go h.readStdin()
+	return h
+}
+
+func (h *handle) readStdin() {
+	if h.inv.Stdin != nil {
+		io.Copy(&h.stdin, h.inv.Stdin)
+	}
+	close(h.stdinDone)
+}
+
+// Pid always returns zero, as no actual process is involved.
+func (h *handle) Pid() int {
+	return 0
+}
+
+// Signal terminates the fake execution as if the process was killed by the
+// signal.
+func (h *handle) Signal(signal syscall.Signal) error {
+	select {
+	case h.signals <- signal:
+	default:
+	}
+	return nil
+}
+
+// Wait writes the canned outputs, waits for the canned delay and reports the
+// canned exit status, unless the context becomes done or a signal is received
+// first.
+func (h *handle) Wait(result *popen.Result) (err error) {
+	if h.inv.Stdout != nil && h.response.Stdout != "" {
+		io.WriteString(h.inv.Stdout, h.response.Stdout)
+	}
+	if h.inv.Stderr != nil && h.response.Stderr != "" {
+		io.WriteString(h.inv.Stderr, h.response.Stderr)
+	}
+
+	var timer = time.NewTimer(h.response.Delay)
+	defer timer.Stop()
+
+	var signal syscall.Signal
+	select {
+	case <-timer.C:
+		select {
+		case <-h.stdinDone:
+		case <-h.inv.Context.Done():
+			signal = h.shutdown(result)
+		case signal = <-h.signals:
+		}
+	case <-h.inv.Context.Done():
+		signal = h.shutdown(result)
+	case signal = <-h.signals:
+	}
+
+	// Closing the files unblocks any pending read of stdin
+	h.inv.CloseFiles()
+	<-h.stdinDone
+
+	if err := h.done(h.stdin.String()); err != nil {
+		result.ExitCode = -1
+		return err
+	}
+	if signal != 0 {
+		result.ExitCode = -1
+		result.Signal = signal
+		return fmt.Errorf("signal: %v", signal)
+	}
+	result.ExitCode = h.response.ExitCode
+	if h.response.ExitCode != 0 {
+		return &ExitError{Code: h.response.ExitCode}
+	}
+	return nil
+}
+
+// shutdown records the shutdown of the fake execution into result and returns
+// the signal that terminates it. As the fake execution ends upon any signal,
+// the first step of the shutdown sequence always ends it.
+func (h *handle) shutdown(result *popen.Result) syscall.Signal {
+	var signal = syscall.SIGKILL
+	if sequence := h.inv.ShutdownSequence(); len(sequence) > 0 {
+		signal = sequence[0].Signal
+	}
+	result.Shutdown = true
+	result.ShutdownStep = 1
+	result.ShutdownSignal = signal
+	h.inv.NotifySignal(signal)
+	return signal
+}
+
+// ExitError is the error reported by commands whose canned response specifies
+// a non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %v", e.Code)
+}
+
+// ExitCode returns the canned exit code.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
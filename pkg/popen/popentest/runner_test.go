@@ -0,0 +1,240 @@
+package popentest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+	"github.com/maargenton/go-fileutils/pkg/popen/popentest"
+)
+
+func TestRunnerCannedResponse(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("git", "status"), popentest.Response{
+		Stdout: "On branch master\n",
+		Stderr: "warning\n",
+	})
+
+	var cmd = popen.Command{
+		Command:   "git",
+		Arguments: []string{"status"},
+		Runner:    &runner,
+	}
+	stdout, stderr, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("On branch master\n")
+	verify.That(t, stderr).Eq("warning\n")
+
+	var calls = runner.Calls()
+	verify.That(t, calls).Length().Eq(1)
+	verify.That(t, calls[0].Command.Command).Eq("git")
+	verify.That(t, calls[0].Matched).IsTrue()
+	verify.That(t, runner.Invoked(popentest.CommandPrefix("git"))).Eq(1)
+}
+
+func TestRunnerExitCode(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.CommandPrefix("make"), popentest.Response{
+		Stderr:   "error: foo\nerror: bar\n",
+		ExitCode: 2,
+	})
+
+	var cmd = popen.Command{
+		Command:         "make",
+		Arguments:       []string{"all"},
+		Runner:          &runner,
+		DiscardStderr:   true,
+		StderrTailLines: 1,
+	}
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, result.ExitCode).Eq(2)
+	verify.That(t, err).ToString().Eq("command failed: make all: exit status 2:\nerror: bar")
+
+	var exitErr *popentest.ExitError
+	verify.That(t, errors.As(err, &exitErr)).IsTrue()
+	verify.That(t, exitErr.Code).Eq(2)
+}
+
+func TestRunnerUnexpectedCommand(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("ls"), popentest.Response{})
+
+	var cmd = popen.Command{
+		Command:   "ls",
+		Arguments: []string{"-l"},
+		Runner:    &runner,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(popentest.ErrUnexpectedCommand)
+	verify.That(t, runner.Calls()).Length().Eq(1)
+	verify.That(t, runner.Calls()[0].Matched).IsFalse()
+}
+
+func TestRunnerStartError(t *testing.T) {
+	var expectedError = errors.New("executable file not found")
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("foo"), popentest.Response{
+		Err: expectedError,
+	})
+
+	var cmd = popen.Command{
+		Command: "foo",
+		Runner:  &runner,
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(expectedError)
+}
+
+func TestRunnerOutputOptions(t *testing.T) {
+	var tmp, _ = ioutil.TempDir("", "popentest-")
+	defer os.RemoveAll(tmp)
+
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("cat"), popentest.Response{
+		Stdout: "foo\nbar\n",
+		Stderr: "baz\n",
+	})
+
+	var lines []string
+	var buf strings.Builder
+	var cmd = popen.Command{
+		Command: "cat",
+		Runner:  &runner,
+		StdinWriter: func(w io.Writer) error {
+			_, err := io.WriteString(w, "Hello World\n")
+			return err
+		},
+		StdoutLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+		StdoutReader: func(r io.Reader) error {
+			_, err := io.Copy(&buf, r)
+			return err
+		},
+		WriteStderrToFile: tmp + "/stderr.txt",
+	}
+	stdout, stderr, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("foo\nbar\n")
+	verify.That(t, stderr).Eq("")
+	verify.That(t, lines).Eq([]string{"foo", "bar"})
+	verify.That(t, buf.String()).Eq("foo\nbar\n")
+
+	content, err := ioutil.ReadFile(tmp + "/stderr.txt")
+	verify.That(t, err).IsNil()
+	verify.That(t, string(content)).Eq("baz\n")
+	verify.That(t, runner.Calls()[0].Stdin).Eq("Hello World\n")
+}
+
+func TestRunnerReaderErrorAbortsCommand(t *testing.T) {
+	var expectedError = errors.New("stdout reader error")
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("sleep"), popentest.Response{
+		Stdout: "Hello\n",
+		Delay:  10 * time.Second,
+	})
+
+	var cmd = popen.Command{
+		Command: "sleep",
+		Runner:  &runner,
+		StdoutReader: func(r io.Reader) error {
+			return expectedError
+		},
+	}
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsError(expectedError)
+}
+
+func TestRunnerDelayHonorsContext(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("sleep"), popentest.Response{
+		Delay: 10 * time.Second,
+	})
+
+	var cmd = popen.Command{
+		Command: "sleep",
+		Runner:  &runner,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var start = time.Now()
+	result, err := cmd.RunResult(ctx)
+	verify.That(t, err).ToString().Eq("signal: killed")
+	verify.That(t, result.Shutdown).IsTrue()
+	verify.That(t, result.Signal).Eq(syscall.SIGKILL)
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+}
+
+func TestRunnerShutdownSequence(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("sleep"), popentest.Response{
+		Delay: 10 * time.Second,
+	})
+
+	var cmd = popen.Command{
+		Command: "sleep",
+		Runner:  &runner,
+		ShutdownSequence: []popen.ShutdownStep{
+			{Signal: syscall.SIGTERM, Wait: time.Second},
+			{Signal: syscall.SIGQUIT, Wait: time.Second},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := cmd.RunResult(ctx)
+	verify.That(t, err).ToString().Eq("signal: terminated")
+	verify.That(t, result.ShutdownStep).Eq(1)
+	verify.That(t, result.ShutdownSignal).Eq(syscall.SIGTERM)
+}
+
+func TestRunnerProcessSignal(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("sleep"), popentest.Response{
+		Delay: 10 * time.Second,
+	})
+
+	var cmd = popen.Command{
+		Command: "sleep",
+		Runner:  &runner,
+	}
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, p.Pid()).Eq(0)
+
+	p.Signal(syscall.SIGTERM)
+	_, _, err = p.Wait()
+	verify.That(t, err).ToString().Eq("signal: terminated")
+}
+
+func TestRunnerPipeline(t *testing.T) {
+	var runner popentest.Runner
+	runner.Expect(popentest.Command("ls"), popentest.Response{
+		Stdout: "foo\nbar\n",
+	})
+	runner.Expect(popentest.Command("sort"), popentest.Response{
+		Stdout: "bar\nfoo\n",
+	})
+
+	var p = popen.Pipeline{
+		Commands: []popen.Command{
+			{Command: "ls", Runner: &runner},
+			{Command: "sort", Runner: &runner},
+		},
+	}
+	stdout, _, err := p.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("bar\nfoo\n")
+	verify.That(t, runner.Calls()[1].Stdin).Eq("foo\nbar\n")
+}
@@ -0,0 +1,32 @@
+package popen
+
+// Credential defines the user and group ids under which a child process runs,
+// as specified in `Command.Credential`.
+type Credential struct {
+	// Uid is the user id of the child process.
+	Uid uint32
+
+	// Gid is the group id of the child process.
+	Gid uint32
+
+	// Groups is the list of supplementary group ids of the child process.
+	Groups []uint32
+
+	// NoSetGroups, if true, leaves the supplementary groups of the child
+	// process unchanged instead of setting them to `Groups`, which requires
+	// privileges.
+	NoSetGroups bool
+}
+
+// Rlimit defines a resource limit of a child process, as specified in
+// `Command.Rlimits`.
+type Rlimit struct {
+	// Resource is the resource to limit, e.g. syscall.RLIMIT_NOFILE.
+	Resource int
+
+	// Cur is the soft limit for the resource.
+	Cur uint64
+
+	// Max is the hard limit for the resource.
+	Max uint64
+}
@@ -0,0 +1,24 @@
+package popen
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+func (c *Command) configurePlatform(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = c.ParentDeathSignal
+}
+
+func setRlimits(pid int, rlimits []Rlimit) error {
+	for _, rlimit := range rlimits {
+		var limit = struct{ Cur, Max uint64 }{rlimit.Cur, rlimit.Max}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+			uintptr(pid), uintptr(rlimit.Resource),
+			uintptr(unsafe.Pointer(&limit)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("failed to set rlimit %v: %w", rlimit.Resource, errno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package popen_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestCommandCredential(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "id",
+		Arguments: []string{"-u"},
+		Credential: &popen.Credential{
+			Uid:         uint32(os.Getuid()),
+			Gid:         uint32(os.Getgid()),
+			NoSetGroups: true,
+		},
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq(strconv.Itoa(os.Getuid()) + "\n")
+}
+
+// Rlimits and Nice are applied right after the child process starts, and are
+// checked from the parent process once Start() returns.
+
+func TestCommandRlimits(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "sleep",
+		Arguments: []string{"10"},
+		Rlimits: []popen.Rlimit{
+			{Resource: syscall.RLIMIT_NOFILE, Cur: 64, Max: 128},
+		},
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+	defer p.Stop(0)
+
+	limits, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/limits", p.Pid()))
+	verify.That(t, err).IsNil()
+	verify.That(t, string(limits)).Matches(`Max open files\s+64\s+128\s`)
+}
+
+func TestCommandRlimitsError(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "sleep",
+		Arguments: []string{"3"},
+		Rlimits: []popen.Rlimit{
+			{Resource: 9999, Cur: 64, Max: 64},
+		},
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).ToString().Contains("failed to set rlimit 9999")
+}
+
+func TestCommandNice(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "sleep",
+		Arguments: []string{"10"},
+		Nice:      5,
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+	defer p.Stop(0)
+
+	// The nice value is the 19th field of /proc/<pid>/stat
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/stat", p.Pid()))
+	verify.That(t, err).IsNil()
+	var fields = strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	verify.That(t, fields[16]).Eq("5")
+}
+
+func TestCommandParentDeathSignal(t *testing.T) {
+	var cmd = popen.Command{
+		Command:           os.Args[0],
+		Arguments:         []string{"-test.run=TestParentDeathSignalHelper"},
+		Env:               []string{"POPEN_PDEATHSIG_HELPER=1"},
+		ParentDeathSignal: syscall.SIGTERM,
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).StartsWith(fmt.Sprintf("pdeathsig %d\n", syscall.SIGTERM))
+}
+
+// TestParentDeathSignalHelper is run as child process by
+// TestCommandParentDeathSignal, and reports its parent death signal.
+func TestParentDeathSignalHelper(t *testing.T) {
+	if os.Getenv("POPEN_PDEATHSIG_HELPER") != "1" {
+		return
+	}
+	const prGetPdeathsig = 2
+	var signal int32
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL,
+		prGetPdeathsig, uintptr(unsafe.Pointer(&signal)), 0)
+	if errno != 0 {
+		t.Fatalf("prctl failed: %v", errno)
+	}
+	fmt.Printf("pdeathsig %d\n", signal)
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package popen
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+func (c *Command) configurePlatform(attr *syscall.SysProcAttr) {
+	// ParentDeathSignal is only supported on Linux
+}
+
+func setRlimits(pid int, rlimits []Rlimit) error {
+	if len(rlimits) == 0 {
+		return nil
+	}
+	return fmt.Errorf("rlimits are not supported on %v", runtime.GOOS)
+}
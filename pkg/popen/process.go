@@ -0,0 +1,85 @@
+package popen
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// Process is a handle to a running command, returned by `Command.Start()`.
+type Process struct {
+	e    *execution
+	done chan struct{}
+
+	result *Result
+	err    error
+}
+
+// Start starts the command as specified and returns immediately with a handle
+// to the running process. The context is monitored until the process exits,
+// with the same shutdown semantic as `Run()`. The captured content of stdout
+// and stderr is returned by `Process.Wait()` once the process has exited.
+func (c *Command) Start(ctx context.Context) (*Process, error) {
+	e, err := c.prepare(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.start(); err != nil {
+		return nil, err
+	}
+
+	var p = &Process{
+		e:    e,
+		done: make(chan struct{}),
+	}
+	go func() {
+		p.result, p.err = e.wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// Pid returns the process id of the child process.
+func (p *Process) Pid() int {
+	return p.e.handle.Pid()
+}
+
+// Signal sends a signal to the child process, or to its entire process group
+// unless `NoProcessGroup` is set. On Windows, only `syscall.SIGKILL` is
+// supported.
+func (p *Process) Signal(signal syscall.Signal) error {
+	return p.e.handle.Signal(signal)
+}
+
+// Done returns a channel that is closed once the process has exited and all
+// its outputs have been processed.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the process to exit and returns the captured content of
+// stdout and stderr if not discarded, along with the same error `Run()` would
+// have returned. It can be called multiple times, and always returns the same
+// result.
+func (p *Process) Wait() (stdout, stderr string, err error) {
+	<-p.done
+	return p.result.Stdout, p.result.Stderr, p.err
+}
+
+// Result waits for the process to exit and returns the detailed result of its
+// execution, along with the same error as `Wait()`.
+func (p *Process) Result() (*Result, error) {
+	<-p.done
+	return p.result, p.err
+}
+
+// Stop triggers the shutdown of the process as if the context had become done,
+// but with the specified grace period for `ShutdownSignal` instead of
+// `ShutdownGracePeriod` or `ShutdownSequence`, then waits for the process to
+// exit and returns the same error as `Wait()`. A zero grace period causes the
+// process to be killed immediately.
+func (p *Process) Stop(gracePeriod time.Duration) error {
+	p.e.stop(gracePeriod)
+	_, _, err := p.Wait()
+	return err
+}
@@ -0,0 +1,72 @@
+package popen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestProcessWait(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo Hello; echo World 1>&2",
+		},
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, p.Pid()).Gt(0)
+
+	<-p.Done()
+	stdout, stderr, err := p.Wait()
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello\n")
+	verify.That(t, stderr).Eq("World\n")
+
+	stdout2, stderr2, err2 := p.Wait()
+	verify.That(t, err2).IsNil()
+	verify.That(t, stdout2).Eq(stdout)
+	verify.That(t, stderr2).Eq(stderr)
+}
+
+func TestProcessStop(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "sleep",
+		Arguments: []string{
+			"10",
+		},
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+
+	select {
+	case <-p.Done():
+		t.Fatal("process exited early")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var start = time.Now()
+	err = p.Stop(0)
+	verify.That(t, err).IsNotNil()
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+
+	_, _, err2 := p.Wait()
+	verify.That(t, err2).Eq(err)
+}
+
+func TestStartWithInvalidCommand(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "__invalid__command__",
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, p).IsNil()
+	verify.That(t, err).ToString().Contains("executable file not found")
+}
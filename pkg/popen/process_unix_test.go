@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package popen_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestProcessSignal(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "sleep",
+		Arguments: []string{
+			"10",
+		},
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+
+	err = p.Signal(syscall.SIGTERM)
+	verify.That(t, err).IsNil()
+
+	_, _, err = p.Wait()
+	verify.That(t, err).ToString().Eq("signal: terminated")
+}
+
+func TestProcessStopGracePeriod(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "sleep",
+		Arguments: []string{
+			"10",
+		},
+		ShutdownSignal: syscall.SIGTERM,
+	}
+
+	p, err := cmd.Start(context.Background())
+	verify.That(t, err).IsNil()
+
+	err = p.Stop(time.Second)
+	verify.That(t, err).ToString().Eq("signal: terminated")
+}
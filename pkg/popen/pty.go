@@ -0,0 +1,7 @@
+package popen
+
+// Default window size of the pseudo-terminal of commands using `UsePTY`.
+const (
+	DefaultPTYRows = 24
+	DefaultPTYCols = 80
+)
@@ -0,0 +1,158 @@
+package popen
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// startPTY starts the child process attached to a new pseudo-terminal, as its
+// controlling terminal and in its own session. The input of the invocation is
+// copied into the terminal, followed by an end-of-file character, and the
+// output of the terminal is copied into the stdout stream of the invocation.
+// Any *os.File among the streams of the invocation is closed once no longer
+// needed.
+func (h *execHandle) startPTY() error {
+	var inv = h.inv
+	master, slave, err := openPTY(inv.Command.PTYRows, inv.Command.PTYCols)
+	if err != nil {
+		inv.CloseFiles()
+		return fmt.Errorf("failed to open pty: %w", err)
+	}
+
+	var cmd = h.cmd
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// A session leader is also the leader of its own process group, which
+	// preserves the semantic of signals sent to the process group
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+
+	err = cmd.Start()
+	slave.Close()
+	inv.closeFile(inv.Stderr)
+	if err != nil {
+		master.Close()
+		inv.closeFile(inv.Stdin)
+		inv.closeFile(inv.Stdout)
+		return err
+	}
+
+	go func() {
+		var w = &lastByteWriter{w: master, last: '\n'}
+		if inv.Stdin != nil {
+			io.Copy(w, inv.Stdin)
+			inv.closeFile(inv.Stdin)
+		}
+		// In canonical mode, an end-of-file character after an unterminated
+		// line only flushes that line; a second one is needed to signal the
+		// end of the input.
+		if w.last != '\n' {
+			master.Write([]byte{ptyEOF})
+		}
+		master.Write([]byte{ptyEOF})
+	}()
+
+	h.pty = master
+	h.ptyDone = make(chan struct{})
+	go func() {
+		var stdout = inv.Stdout
+		if stdout == nil {
+			stdout = ioutil.Discard
+		}
+		// Reading the terminal fails with EIO once all the processes attached
+		// to it have closed it. The terminal itself must remain open until the
+		// child process has exited, as closing it causes a SIGHUP.
+		io.Copy(stdout, master)
+		inv.closeFile(inv.Stdout)
+		close(h.ptyDone)
+	}()
+	return nil
+}
+
+// lastByteWriter is an io.Writer that keeps track of the last byte written.
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (w *lastByteWriter) Write(p []byte) (n int, err error) {
+	n, err = w.w.Write(p)
+	if n > 0 {
+		w.last = p[n-1]
+	}
+	return
+}
+
+// ptyEOF is the character interpreted as end-of-file by a terminal in
+// canonical mode, i.e. ctrl-D.
+const ptyEOF = 0x04
+
+// openPTY allocates a new pseudo-terminal through /dev/ptmx, with the
+// specified window size, and returns both its ends.
+func openPTY(rows, cols int) (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+
+	if rows <= 0 {
+		rows = DefaultPTYRows
+	}
+	if cols <= 0 {
+		cols = DefaultPTYCols
+	}
+	var unlock int32
+	var n uint32
+	var size = struct{ Row, Col, Xpixel, Ypixel uint16 }{
+		Row: uint16(rows),
+		Col: uint16(cols),
+	}
+	if err = ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		return nil, nil, err
+	}
+	if err = ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		return nil, nil, err
+	}
+	if err = ioctl(master, syscall.TIOCSWINSZ, unsafe.Pointer(&size)); err != nil {
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// ioctl issues an ioctl on f without switching it to blocking mode, as
+// f.Fd() would.
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package popen_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestCommandUsePTY(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "test -t 0 && test -t 1 && test -t 2 && tty"},
+		UsePTY:    true,
+	}
+
+	stdout, stderr, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).StartsWith("/dev/pts/")
+	verify.That(t, stdout).EndsWith("\r\n")
+	verify.That(t, stderr).Eq("")
+}
+
+func TestCommandUsePTYWindowSize(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "stty",
+		Arguments: []string{"size"},
+		UsePTY:    true,
+		PTYRows:   40,
+		PTYCols:   120,
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("40 120\r\n")
+}
+
+func TestCommandUsePTYStdin(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "cat",
+		Stdin:   "Hello World\n",
+		UsePTY:  true,
+	}
+
+	stdout, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, stdout).Eq("Hello World\r\nHello World\r\n")
+}
+
+func TestCommandUsePTYLineHandler(t *testing.T) {
+	var lines []string
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", "echo foo; echo bar >&2"},
+		UsePTY:    true,
+		StdoutLineHandler: func(line string) error {
+			lines = append(lines, line)
+			return nil
+		},
+	}
+
+	_, _, err := cmd.Run(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, lines).Eq([]string{"foo", "bar"})
+}
+
+func TestCommandUsePTYShutdown(t *testing.T) {
+	var cmd = popen.Command{
+		Command:             "sleep",
+		Arguments:           []string{"3"},
+		UsePTY:              true,
+		ShutdownGracePeriod: 200 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	_, _, err := cmd.Run(ctx)
+	verify.That(t, err).ToString().Eq("signal: interrupt")
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
+
+func TestSessionUsePTY(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "bash",
+		Arguments: []string{"-c", `read -p "name? " name; echo "hello $name"`},
+		UsePTY:    true,
+	}
+	s, err := cmd.StartSession(context.Background())
+	verify.That(t, err).IsNil()
+
+	_, err = s.Expect(regexp.MustCompile(`name\? $`), time.Second)
+	verify.That(t, err).IsNil()
+	verify.That(t, s.Send("world\n")).IsNil()
+
+	_, err = s.Expect(regexp.MustCompile(`hello world\r\n`), time.Second)
+	verify.That(t, err).IsNil()
+	verify.That(t, s.ExpectEOF()).IsNil()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package popen
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (h *execHandle) startPTY() error {
+	return fmt.Errorf("pty is not supported on %v", runtime.GOOS)
+}
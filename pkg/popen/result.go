@@ -0,0 +1,84 @@
+package popen
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// Result captures the outcome of the execution of a command, as returned by
+// `Command.RunResult()` and `Process.Result()`.
+type Result struct {
+	// Stdout is the captured content of stdout, if not discarded.
+	Stdout string
+
+	// Stderr is the captured content of stderr, if not discarded.
+	Stderr string
+
+	// StdoutTruncated is true if the captured content of stdout was truncated
+	// because it exceeded `MaxStdoutBytes`.
+	StdoutTruncated bool
+
+	// StdoutDroppedBytes is the number of bytes of stdout that were dropped
+	// from the captured content because it exceeded `MaxStdoutBytes`.
+	StdoutDroppedBytes int64
+
+	// StderrTruncated is true if the captured content of stderr was truncated
+	// because it exceeded `MaxStderrBytes`.
+	StderrTruncated bool
+
+	// StderrDroppedBytes is the number of bytes of stderr that were dropped
+	// from the captured content because it exceeded `MaxStderrBytes`.
+	StderrDroppedBytes int64
+
+	// Output contains all the chunks of stdout and stderr, in the order they
+	// were received, if recorded with `CombinedOutput`.
+	Output []OutputChunk
+
+	// ExitCode is the exit status of the child process, or -1 if the process
+	// was terminated by a signal.
+	ExitCode int
+
+	// Signal is the signal that terminated the child process, if any. It is
+	// always zero on Windows.
+	Signal syscall.Signal
+
+	// Shutdown is true if the context became done before the child process
+	// exited, triggering the shutdown sequence, with or without a grace period.
+	Shutdown bool
+
+	// ShutdownStep is the 1-based index of the step of the shutdown sequence
+	// that ended the child process, counting the final kill as the step after
+	// the last one, or zero if the shutdown sequence was not triggered. On
+	// Windows, where the process is killed immediately, it is always 1.
+	ShutdownStep int
+
+	// ShutdownSignal is the signal sent by the step of the shutdown sequence
+	// that ended the child process, syscall.SIGKILL for the final kill.
+	ShutdownSignal syscall.Signal
+
+	// Duration is the wall-clock time elapsed between the start of the child
+	// process and its exit.
+	Duration time.Duration
+
+	// UserTime is the user CPU time of the child process.
+	UserTime time.Duration
+
+	// SystemTime is the system CPU time of the child process.
+	SystemTime time.Duration
+
+	// MaxRSS is the maximum resident set size of the child process, in bytes.
+	// It is always zero on Windows.
+	MaxRSS int64
+}
+
+// RunResult executes the command as specified, like `Run()`, but returns a
+// detailed result of the execution. The returned result is non-nil as long as
+// the child process was started, even if an error is also returned.
+func (c *Command) RunResult(ctx context.Context) (*Result, error) {
+	p, err := c.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.Result()
+}
@@ -0,0 +1,40 @@
+package popen_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestRunResult(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{
+			"-c",
+			"echo Hello; echo World 1>&2; exit 3",
+		},
+	}
+
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, err).ToString().Eq("exit status 3")
+	verify.That(t, result).IsNotNil()
+	verify.That(t, result.Stdout).Eq("Hello\n")
+	verify.That(t, result.Stderr).Eq("World\n")
+	verify.That(t, result.ExitCode).Eq(3)
+	verify.That(t, int(result.Signal)).Eq(0)
+	verify.That(t, result.Shutdown).IsFalse()
+	verify.That(t, result.Duration.Seconds()).Gt(0.0)
+}
+
+func TestRunResultWithInvalidCommand(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "__invalid__command__",
+	}
+
+	result, err := cmd.RunResult(context.Background())
+	verify.That(t, result).IsNil()
+	verify.That(t, err).ToString().Contains("executable file not found")
+}
@@ -0,0 +1,136 @@
+package popen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMaxAttempts is the maximum number of attempts of a Retry that does
+// not specify `MaxAttempts`.
+const DefaultMaxAttempts = 3
+
+// Retry runs a command, retrying it with an exponential backoff when it fails
+// with an error deemed transient.
+type Retry struct {
+	// Command is the command to run. Each attempt runs the command as is,
+	// with the context passed to `Run()`.
+	Command Command
+
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// It defaults to `DefaultMaxAttempts`.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the second attempt, multiplied by
+	// `BackoffMultiplier` before each subsequent attempt, up to `MaxBackoff`.
+	// They default to `DefaultInitialBackoff`, `DefaultMaxBackoff` and
+	// `DefaultBackoffMultiplier` respectively.
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// Jitter, between 0 and 1, randomizes each delay by up to that fraction of
+	// the delay, in either direction.
+	Jitter float64
+
+	// ShouldRetry, if not nil, is called after each failed attempt, with the
+	// result of the attempt and its error, and decides whether the command
+	// should be retried. The result, which exposes the exit code and the
+	// captured stderr of the attempt, is nil if the command could not be
+	// started. By default, all failures are retried.
+	ShouldRetry func(result *Result, err error) bool
+}
+
+// RetryError is the error returned when all the attempts of a Retry fail.
+type RetryError struct {
+	// Command is the name of the command.
+	Command string
+
+	// Attempts is the number of attempts made.
+	Attempts int
+
+	// Errors contains the errors returned by each attempt, in order, followed
+	// by the context error if the context became done between attempts.
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "command '%v' failed after %v attempts", e.Command, e.Attempts)
+	for i, err := range e.Errors {
+		if i < e.Attempts {
+			fmt.Fprintf(&b, "\n- attempt %v: %v", i+1, err)
+		} else {
+			fmt.Fprintf(&b, "\n- %v", err)
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the last error, i.e. the error of the last attempt or the
+// context error.
+func (e *RetryError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+// Is reports whether the error of any attempt matches target.
+func (e *RetryError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of any attempt that matches target, and if so, sets
+// target to that error value and returns true.
+func (e *RetryError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the command until it succeeds, `ShouldRetry` returns false, the
+// maximum number of attempts is reached or the context becomes done, and
+// returns the result of the last attempt. If the command never succeeds, the
+// returned error is a *RetryError that carries the error of every attempt.
+func (r *Retry) Run(ctx context.Context) (*Result, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var maxAttempts = r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	var b = newBackoff(r.InitialBackoff, r.MaxBackoff, r.BackoffMultiplier, r.Jitter)
+	var retryErr = &RetryError{Command: r.Command.Command}
+	var delay time.Duration
+
+	for {
+		result, err := r.Command.RunResult(ctx)
+		if err == nil {
+			return result, nil
+		}
+		retryErr.Attempts++
+		retryErr.Errors = append(retryErr.Errors, err)
+		if retryErr.Attempts >= maxAttempts || ctx.Err() != nil ||
+			(r.ShouldRetry != nil && !r.ShouldRetry(result, err)) {
+			return result, retryErr
+		}
+
+		delay = b.next(delay)
+		if err := sleep(ctx, b.randomize(delay)); err != nil {
+			retryErr.Errors = append(retryErr.Errors, err)
+			return result, retryErr
+		}
+	}
+}
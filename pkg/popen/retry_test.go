@@ -0,0 +1,103 @@
+package popen_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestRetrySucceedsAfterTransientFailures(t *testing.T) {
+	var tmp = tempDir(t)
+	var counter = fileutils.Join(tmp, "counter")
+	var r = popen.Retry{
+		Command: popen.Command{
+			Command: "bash",
+			Arguments: []string{"-c", `
+				n=$(cat ` + counter + ` 2>/dev/null || echo 0)
+				echo $((n+1)) > ` + counter + `
+				[ $n -ge 2 ] && echo done`},
+		},
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+	}
+	result, err := r.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, result.Stdout).Eq("done\n")
+	verify.That(t, readFile(t, counter)).Eq("3\n")
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var r = popen.Retry{
+		Command: popen.Command{
+			Command:   "bash",
+			Arguments: []string{"-c", "exit 3"},
+		},
+		InitialBackoff: time.Millisecond,
+		Jitter:         0.5,
+	}
+	result, err := r.Run(context.Background())
+	verify.That(t, result.ExitCode).Eq(3)
+
+	var retryErr *popen.RetryError
+	verify.That(t, errors.As(err, &retryErr)).IsTrue()
+	verify.That(t, retryErr.Attempts).Eq(popen.DefaultMaxAttempts)
+	verify.That(t, retryErr.Errors).Length().Eq(popen.DefaultMaxAttempts)
+	verify.That(t, err).ToString().StartsWith("command 'bash' failed after 3 attempts")
+	verify.That(t, err).ToString().Contains("attempt 3: exit status 3")
+
+	var exitErr *exec.ExitError
+	verify.That(t, errors.As(err, &exitErr)).IsTrue()
+}
+
+func TestRetryShouldRetry(t *testing.T) {
+	var calls int
+	var r = popen.Retry{
+		Command: popen.Command{
+			Command:   "bash",
+			Arguments: []string{"-c", "echo 'fatal: not found' >&2; exit 128"},
+		},
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		ShouldRetry: func(result *popen.Result, err error) bool {
+			calls++
+			return result.ExitCode == 128 && !strings.Contains(result.Stderr, "not found")
+		},
+	}
+	_, err := r.Run(context.Background())
+
+	var retryErr *popen.RetryError
+	verify.That(t, errors.As(err, &retryErr)).IsTrue()
+	verify.That(t, retryErr.Attempts).Eq(1)
+	verify.That(t, calls).Eq(1)
+}
+
+func TestRetryContextCancelledBetweenAttempts(t *testing.T) {
+	var r = popen.Retry{
+		Command: popen.Command{
+			Command:   "bash",
+			Arguments: []string{"-c", "exit 1"},
+		},
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Second,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var start = time.Now()
+	_, err := r.Run(ctx)
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+	verify.That(t, err).IsError(context.DeadlineExceeded)
+
+	var retryErr *popen.RetryError
+	verify.That(t, errors.As(err, &retryErr)).IsTrue()
+	verify.That(t, retryErr.Attempts).Eq(1)
+	verify.That(t, retryErr.Errors).Length().Eq(2)
+}
@@ -0,0 +1,187 @@
+package popen
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Runner is the interface through which all commands are executed. The
+// default runner, `ExecRunner`, spawns actual child processes; alternate
+// implementations can execute commands without spawning any process, typically
+// for testing purposes (see package popentest).
+type Runner interface {
+	// Start starts the execution of the command described by inv. It takes
+	// ownership of the *os.File among the standard streams of the invocation
+	// and must close them through `Invocation.CloseFiles()` once they are no
+	// longer needed, whether the execution is started successfully or not.
+	Start(inv *Invocation) (Handle, error)
+}
+
+// Handle is the interface to an execution started by a Runner.
+type Handle interface {
+	// Pid returns the process id of the child process, if any, or zero.
+	Pid() int
+
+	// Signal sends a signal to the child process.
+	Signal(signal syscall.Signal) error
+
+	// Wait waits for the execution to complete, shutting it down if the
+	// context of the invocation becomes done first, and fills in the exit
+	// status fields of result. A non-zero exit status must be reported as an
+	// error that implements `ExitCode() int`, like *exec.ExitError.
+	Wait(result *Result) error
+}
+
+// Invocation describes a single execution of a command, as passed to a
+// Runner.
+type Invocation struct {
+	// Context is the context of the execution. When it becomes done, the
+	// execution should be shut down.
+	Context context.Context
+
+	// Command is the command to execute. It must not be modified.
+	Command *Command
+
+	// Env is the effective environment of the command, or nil if the command
+	// inherits the environment of the current process.
+	Env []string
+
+	// Stdin is the stdin input of the command, or nil if the command has no
+	// input.
+	Stdin io.Reader
+
+	// Stdout is the destination of the stdout stream of the command, or nil if
+	// the stream is discarded.
+	Stdout io.Writer
+
+	// Stderr is the destination of the stderr stream of the command, or nil if
+	// the stream is discarded.
+	Stderr io.Writer
+
+	// ExtraFiles are additional open files inherited by the child process, as
+	// file descriptors 3 and up. Unlike the standard streams, they remain
+	// owned by the caller and must not be closed by the Runner.
+	ExtraFiles []*os.File
+
+	e        *execution
+	borrowed []*os.File
+}
+
+// ShutdownSequence returns the sequence of signals to send when shutting down
+// the execution after its context becomes done, before killing it. It is
+// derived from the shutdown options of the command, unless overridden by
+// `Process.Stop()`.
+func (inv *Invocation) ShutdownSequence() []ShutdownStep {
+	if inv.e == nil {
+		return inv.Command.shutdownSequence()
+	}
+	return inv.e.shutdownSequence()
+}
+
+// CloseFiles closes any *os.File among the standard streams of the invocation,
+// as required from Runner implementations. Files passed by the caller through
+// `StdoutWriter` or `StderrWriter` remain open.
+func (inv *Invocation) CloseFiles() {
+	for _, s := range []interface{}{inv.Stdin, inv.Stdout, inv.Stderr} {
+		inv.closeFile(s)
+	}
+}
+
+// closeFile closes s if it is an *os.File owned by the invocation.
+func (inv *Invocation) closeFile(s interface{}) {
+	f, ok := s.(*os.File)
+	if !ok {
+		return
+	}
+	for _, b := range inv.borrowed {
+		if f == b {
+			return
+		}
+	}
+	f.Close()
+}
+
+// keepOpen records w as owned by the caller if it is an *os.File, to prevent
+// it from being closed by `CloseFiles()`.
+func (inv *Invocation) keepOpen(w io.Writer) {
+	if f, ok := w.(*os.File); ok {
+		inv.borrowed = append(inv.borrowed, f)
+	}
+}
+
+// DefaultRunner is the runner used to execute commands that do not specify
+// their own `Runner`.
+var DefaultRunner Runner = ExecRunner{}
+
+// ExecRunner is the default implementation of Runner, that executes commands
+// by spawning child processes through `os/exec`.
+type ExecRunner struct{}
+
+var _ Runner = ExecRunner{}
+
+// Start starts a child process executing the command described by inv.
+func (ExecRunner) Start(inv *Invocation) (Handle, error) {
+	var c = inv.Command
+	path, name, err := c.lookPath(inv.Env)
+	if err != nil {
+		inv.CloseFiles()
+		return nil, err
+	}
+	// The child process sees the command name as written, not its resolved
+	// path, as argv[0]
+	var cmd = exec.Command(path, c.Arguments...)
+	cmd.Args[0] = name
+	cmd.Dir = c.Directory
+	cmd.Env = inv.Env
+	cmd.Stdin = inv.Stdin
+	cmd.Stdout = inv.Stdout
+	cmd.Stderr = inv.Stderr
+	cmd.ExtraFiles = inv.ExtraFiles
+	c.configureCommand(cmd)
+
+	// The child process holds its own copies of any file passed to it
+	var h = &execHandle{inv: inv, cmd: cmd}
+	if c.UsePTY {
+		err = h.startPTY()
+	} else {
+		err = cmd.Start()
+		inv.CloseFiles()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.configureProcess(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		h.Wait(&Result{})
+		return nil, err
+	}
+	return h, nil
+}
+
+type execHandle struct {
+	inv     *Invocation
+	cmd     *exec.Cmd
+	pty     *os.File
+	ptyDone chan struct{}
+}
+
+func (h *execHandle) Pid() int {
+	return h.cmd.Process.Pid
+}
+
+func (h *execHandle) Signal(signal syscall.Signal) error {
+	return h.inv.Command.kill(h.cmd, signal)
+}
+
+func (h *execHandle) Wait(result *Result) error {
+	var err = h.wait(result)
+	if h.pty != nil {
+		<-h.ptyDone
+		h.pty.Close()
+	}
+	result.setProcessState(h.cmd.ProcessState)
+	return err
+}
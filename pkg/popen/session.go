@@ -0,0 +1,217 @@
+package popen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maargenton/go-errors"
+)
+
+// ErrExpectTimeout is a sentinel error returned by `Session.Expect()` when the
+// expected pattern does not show up in the output of the command before the
+// timeout.
+var ErrExpectTimeout = errors.Sentinel("ErrExpectTimeout")
+
+// ErrUnexpectedEOF is a sentinel error returned by `Session.Expect()` when the
+// output of the command ends before the expected pattern shows up.
+var ErrUnexpectedEOF = errors.Sentinel("ErrUnexpectedEOF")
+
+// Session is an expect-style driver for interactive commands like REPLs,
+// database shells or installers. It sends input to the command and waits for
+// patterns to show up in its output, capturing a transcript of the whole
+// exchange.
+type Session struct {
+	p *Process
+
+	mutex      sync.Mutex
+	output     []byte
+	transcript strings.Builder
+	readers    int
+	eof        bool
+	changed    chan struct{}
+
+	stdin      chan io.Writer
+	stdinMutex sync.Mutex
+	stdinOnce  sync.Once
+	stdinDone  chan struct{}
+}
+
+// StartSession starts the command as an interactive session. The session takes
+// over the `StdinWriter`, `StdoutReader` and `StderrReader` options of the
+// command, and matches patterns against the combined output of stdout and
+// stderr, as displayed by a terminal; all the other options apply as usual.
+// The context is monitored until the command exits, with the same shutdown
+// semantic as `Run()`.
+func (c *Command) StartSession(ctx context.Context) (*Session, error) {
+	var s = &Session{
+		readers:   2,
+		changed:   make(chan struct{}),
+		stdin:     make(chan io.Writer, 1),
+		stdinDone: make(chan struct{}),
+	}
+
+	var cmd = *c
+	cmd.StdinWriter = func(w io.Writer) error {
+		s.stdin <- w
+		<-s.stdinDone
+		return nil
+	}
+	cmd.StdoutReader = s.readOutput
+	cmd.StderrReader = s.readOutput
+
+	p, err := cmd.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.p = p
+	return s, nil
+}
+
+// Process returns the underlying process of the session.
+func (s *Session) Process() *Process {
+	return s.p
+}
+
+// Send writes input to the stdin of the command.
+func (s *Session) Send(input string) error {
+	s.stdinMutex.Lock()
+	defer s.stdinMutex.Unlock()
+
+	var w io.Writer
+	select {
+	case <-s.stdinDone:
+	case w = <-s.stdin:
+		s.stdin <- w
+	}
+	select {
+	case <-s.stdinDone:
+		return fmt.Errorf("failed to send input: stdin is closed")
+	default:
+	}
+
+	s.mutex.Lock()
+	s.transcript.WriteString(input)
+	s.mutex.Unlock()
+
+	_, err := io.WriteString(w, input)
+	return err
+}
+
+// CloseStdin closes the stdin of the command, signaling the end of its input.
+func (s *Session) CloseStdin() {
+	s.stdinOnce.Do(func() {
+		close(s.stdinDone)
+	})
+}
+
+// Expect waits for re to match the output of the command not yet consumed by
+// previous calls, consumes the output up to the end of the match, and returns
+// the matched text followed by any submatches. If timeout is non-zero and re
+// does not match within that time, an error matching `ErrExpectTimeout` is
+// returned; if the output ends before re matches, the returned error matches
+// `ErrUnexpectedEOF`.
+func (s *Session) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		var timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		s.mutex.Lock()
+		if loc := re.FindSubmatchIndex(s.output); loc != nil {
+			var match = make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(s.output[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			s.output = s.output[loc[1]:]
+			s.mutex.Unlock()
+			return match, nil
+		}
+		var eof, changed, pending = s.eof, s.changed, string(s.output)
+		s.mutex.Unlock()
+
+		if eof {
+			return nil, ErrUnexpectedEOF.Errorf(
+				"output ended before matching '%v', pending output: %q",
+				re, pending)
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return nil, ErrExpectTimeout.Errorf(
+				"no match for '%v' after %v, pending output: %q",
+				re, timeout, pending)
+		}
+	}
+}
+
+// ExpectEOF waits for the command to exit, discarding any remaining output,
+// and returns the same error as `Process.Wait()`. The stdin of the command is
+// left open, and the command must exit on its own or through its context.
+func (s *Session) ExpectEOF() error {
+	_, _, err := s.p.Wait()
+	return err
+}
+
+// Close closes the stdin of the command and waits for it to exit for up to
+// timeout, then triggers its shutdown sequence as if the context had become
+// done if it is still running. It returns the same error as `Process.Wait()`.
+func (s *Session) Close(timeout time.Duration) error {
+	s.CloseStdin()
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.p.Done():
+	case <-timer.C:
+		s.p.e.cancel()
+	}
+	return s.ExpectEOF()
+}
+
+// Transcript returns the whole exchange with the command so far, i.e. all the
+// input sent and all the output received, in order. When the command is run
+// with `UsePTY`, the input is also echoed back in the output by the terminal.
+func (s *Session) Transcript() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.transcript.String()
+}
+
+// readOutput reads one of the output streams of the command into the session,
+// until the end of the stream.
+func (s *Session) readOutput(r io.Reader) error {
+	var p = make([]byte, 4096)
+	for {
+		n, err := r.Read(p)
+		s.mutex.Lock()
+		if n > 0 {
+			s.output = append(s.output, p[:n]...)
+			s.transcript.Write(p[:n])
+		}
+		if err != nil {
+			s.readers--
+			s.eof = s.readers == 0
+		}
+		var eof = s.eof
+		close(s.changed)
+		s.changed = make(chan struct{})
+		s.mutex.Unlock()
+
+		if eof {
+			// The command has exited; release the stdin writer
+			s.CloseStdin()
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package popen_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func TestSession(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "bash",
+		Arguments: []string{"-c", `
+			while printf "> "; read line; do
+				echo "you said: $line"
+			done
+			echo bye >&2`},
+	}
+	s, err := cmd.StartSession(context.Background())
+	verify.That(t, err).IsNil()
+
+	_, err = s.Expect(regexp.MustCompile(`> $`), time.Second)
+	verify.That(t, err).IsNil()
+	verify.That(t, s.Send("hello\n")).IsNil()
+
+	match, err := s.Expect(regexp.MustCompile(`you said: (\w+)`), time.Second)
+	verify.That(t, err).IsNil()
+	verify.That(t, match).Eq([]string{"you said: hello", "hello"})
+
+	_, err = s.Expect(regexp.MustCompile(`> $`), time.Second)
+	verify.That(t, err).IsNil()
+	s.CloseStdin()
+
+	_, err = s.Expect(regexp.MustCompile(`bye`), time.Second)
+	verify.That(t, err).IsNil()
+	verify.That(t, s.ExpectEOF()).IsNil()
+	verify.That(t, s.Transcript()).Eq("> hello\nyou said: hello\n> bye\n")
+}
+
+func TestSessionExpectTimeout(t *testing.T) {
+	var cmd = popen.Command{
+		Command: "cat",
+	}
+	s, err := cmd.StartSession(context.Background())
+	verify.That(t, err).IsNil()
+	verify.That(t, s.Send("foo\n")).IsNil()
+
+	_, err = s.Expect(regexp.MustCompile(`bar`), 100*time.Millisecond)
+	verify.That(t, err).IsError(popen.ErrExpectTimeout)
+	verify.That(t, err).ToString().Contains(`pending output: "foo\n"`)
+
+	verify.That(t, s.Close(time.Second)).IsNil()
+}
+
+func TestSessionClose(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "sleep",
+		Arguments: []string{"3"},
+	}
+	s, err := cmd.StartSession(context.Background())
+	verify.That(t, err).IsNil()
+
+	var start = time.Now()
+	verify.That(t, s.Close(100*time.Millisecond)).ToString().Eq("signal: killed")
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
+
+func TestSessionExpectUnexpectedEOF(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "echo",
+		Arguments: []string{"foo"},
+	}
+	s, err := cmd.StartSession(context.Background())
+	verify.That(t, err).IsNil()
+
+	_, err = s.Expect(regexp.MustCompile(`bar`), 0)
+	verify.That(t, err).IsError(popen.ErrUnexpectedEOF)
+	verify.That(t, s.ExpectEOF()).IsNil()
+	verify.That(t, s.Send("foo\n")).IsNotNil()
+}
+
+func TestSessionContextCanceled(t *testing.T) {
+	var cmd = popen.Command{
+		Command:   "sleep",
+		Arguments: []string{"3"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var start = time.Now()
+	s, err := cmd.StartSession(ctx)
+	verify.That(t, err).IsNil()
+
+	_, err = s.Expect(regexp.MustCompile(`foo`), 0)
+	verify.That(t, err).IsError(popen.ErrUnexpectedEOF)
+	verify.That(t, s.ExpectEOF()).IsNotNil()
+	verify.That(t, time.Since(start).Seconds()).Lt(2.0)
+}
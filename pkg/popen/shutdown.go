@@ -0,0 +1,40 @@
+package popen
+
+import (
+	"syscall"
+	"time"
+)
+
+// ShutdownStep is a single step of the shutdown sequence of a command.
+type ShutdownStep struct {
+	// Signal is the signal sent to the child process, or to its entire process
+	// group unless `NoProcessGroup` is set.
+	Signal syscall.Signal
+
+	// Wait is how long to wait for the child process to exit after sending the
+	// signal, before moving on to the next step.
+	Wait time.Duration
+}
+
+// shutdownSequence returns the effective shutdown sequence of the command,
+// excluding the final kill.
+func (c *Command) shutdownSequence() []ShutdownStep {
+	if len(c.ShutdownSequence) > 0 {
+		return c.ShutdownSequence
+	}
+	return c.singleStepSequence(c.ShutdownGracePeriod)
+}
+
+// singleStepSequence returns the shutdown sequence equivalent to sending
+// `ShutdownSignal` with the specified grace period, or an empty sequence if the
+// grace period is zero.
+func (c *Command) singleStepSequence(gracePeriod time.Duration) []ShutdownStep {
+	if gracePeriod == 0 {
+		return nil
+	}
+	var signal = c.ShutdownSignal
+	if signal == 0 {
+		signal = syscall.SIGINT
+	}
+	return []ShutdownStep{{Signal: signal, Wait: gracePeriod}}
+}
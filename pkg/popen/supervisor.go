@@ -0,0 +1,218 @@
+package popen
+
+import (
+	"context"
+	"time"
+
+	"github.com/maargenton/go-errors"
+)
+
+// ErrTooManyRestarts is a sentinel error returned by `Supervisor.Run()` when
+// the supervised command exceeds the maximum number of restarts allowed by the
+// supervisor.
+var ErrTooManyRestarts = errors.Sentinel("ErrTooManyRestarts")
+
+// RestartPolicy defines when a Supervisor restarts its command after it exits.
+type RestartPolicy int
+
+const (
+	// RestartAlways restarts the command whenever it exits, whether it
+	// succeeds or fails. This is the default policy.
+	RestartAlways RestartPolicy = iota
+
+	// RestartOnFailure restarts the command only when it fails or cannot be
+	// started; the supervisor stops once the command succeeds.
+	RestartOnFailure
+)
+
+// Supervisor runs a long-lived command, restarting it according to a restart
+// policy, with an exponential backoff between restarts.
+type Supervisor struct {
+	// Command is the command to supervise. Each run of the command is
+	// started with the context of the supervisor, and shut down through its
+	// shutdown options, like `ShutdownSignal` and `ShutdownGracePeriod`, when
+	// the context becomes done.
+	Command Command
+
+	// Restart is the restart policy of the supervisor.
+	Restart RestartPolicy
+
+	// MaxRestarts, if non-zero, is the maximum number of restarts allowed
+	// within `RestartWindow`, or over the whole lifetime of the supervisor if
+	// `RestartWindow` is zero. When the command exits and exceeds this limit,
+	// it is not restarted and the supervisor fails with `ErrTooManyRestarts`.
+	MaxRestarts int
+
+	// RestartWindow is the sliding time window over which restarts are counted
+	// against `MaxRestarts`.
+	RestartWindow time.Duration
+
+	// InitialBackoff is the delay before the first restart, multiplied by
+	// `BackoffMultiplier` on each consecutive restart, up to `MaxBackoff`. A
+	// run that lasts longer than `MaxBackoff` resets the delay to
+	// `InitialBackoff`. They default to `DefaultInitialBackoff`,
+	// `DefaultMaxBackoff` and `DefaultBackoffMultiplier` respectively.
+	InitialBackoff    time.Duration
+	MaxBackoff        time.Duration
+	BackoffMultiplier float64
+
+	// Jitter, between 0 and 1, randomizes each restart delay by up to that
+	// fraction of the delay, in either direction, to avoid synchronized
+	// restarts of multiple supervised commands.
+	Jitter float64
+
+	// Events, if not nil, receives the lifecycle events of the supervised
+	// command, and is closed when `Run()` returns. Events are sent
+	// synchronously; the channel must be buffered or drained concurrently for
+	// the supervisor to make progress.
+	Events chan<- SupervisorEvent
+}
+
+// SupervisorEventType identifies the type of a SupervisorEvent.
+type SupervisorEventType int
+
+const (
+	// CommandStarted is sent when the command is started.
+	CommandStarted SupervisorEventType = iota
+
+	// CommandExited is sent when the command exits or fails to start.
+	CommandExited
+
+	// CommandRestarting is sent before waiting for the backoff delay and
+	// restarting the command.
+	CommandRestarting
+
+	// SupervisorStopped is the last event, sent when the supervisor stops.
+	SupervisorStopped
+)
+
+func (t SupervisorEventType) String() string {
+	switch t {
+	case CommandStarted:
+		return "started"
+	case CommandExited:
+		return "exited"
+	case CommandRestarting:
+		return "restarting"
+	case SupervisorStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// SupervisorEvent describes a lifecycle event of a command run by a
+// Supervisor.
+type SupervisorEvent struct {
+	// Type is the type of the event.
+	Type SupervisorEventType
+
+	// Time is the time at which the event occurred.
+	Time time.Time
+
+	// Restarts is the number of times the command has been restarted so far.
+	Restarts int
+
+	// Pid is the process id of the current run of the command, if started.
+	Pid int
+
+	// Result is the result of the run of the command, for `CommandExited`
+	// events, or nil if the command could not be started.
+	Result *Result
+
+	// Err is the error returned by the run of the command for `CommandExited`
+	// events, or the error returned by `Run()` for `SupervisorStopped` events.
+	Err error
+
+	// Backoff is the delay before restarting the command, for
+	// `CommandRestarting` events.
+	Backoff time.Duration
+}
+
+// Run runs and supervises the command until it stops according to the restart
+// policy, fails too many times, or the context becomes done. When the context
+// becomes done, the current run of the command is shut down and Run returns
+// the context error. Otherwise it returns nil if the last run succeeded, or an
+// error matching `ErrTooManyRestarts` and wrapping the error of the last run.
+func (s *Supervisor) Run(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s.Events != nil {
+		defer close(s.Events)
+	}
+
+	var b = newBackoff(s.InitialBackoff, s.MaxBackoff, s.BackoffMultiplier, s.Jitter)
+	var restarts []time.Time
+	var count int
+	var backoff time.Duration
+	for {
+		var startTime = time.Now()
+		var result *Result
+		var pid int
+		p, err := s.Command.Start(ctx)
+		if err == nil {
+			pid = p.Pid()
+			s.emit(SupervisorEvent{Type: CommandStarted, Restarts: count, Pid: pid})
+			result, err = p.Result()
+		}
+		s.emit(SupervisorEvent{
+			Type: CommandExited, Restarts: count, Pid: pid,
+			Result: result, Err: err,
+		})
+
+		switch {
+		case ctx.Err() != nil:
+			return s.stop(count, ctx.Err())
+		case err == nil && s.Restart == RestartOnFailure:
+			return s.stop(count, nil)
+		}
+
+		var now = time.Now()
+		restarts = s.recentRestarts(restarts, now)
+		if s.MaxRestarts > 0 && len(restarts) >= s.MaxRestarts {
+			err = ErrTooManyRestarts.Errorf(
+				"command '%v' exceeded %v restarts: %w",
+				s.Command.Command, s.MaxRestarts, err)
+			return s.stop(count, err)
+		}
+		restarts = append(restarts, now)
+		count++
+
+		if now.Sub(startTime) > b.max {
+			backoff = 0
+		}
+		backoff = b.next(backoff)
+		var delay = b.randomize(backoff)
+		s.emit(SupervisorEvent{Type: CommandRestarting, Restarts: count, Backoff: delay})
+
+		if err := sleep(ctx, delay); err != nil {
+			return s.stop(count, err)
+		}
+	}
+}
+
+// stop sends the final event of the supervisor and returns err.
+func (s *Supervisor) stop(restarts int, err error) error {
+	s.emit(SupervisorEvent{Type: SupervisorStopped, Restarts: restarts, Err: err})
+	return err
+}
+
+func (s *Supervisor) emit(event SupervisorEvent) {
+	if s.Events != nil {
+		event.Time = time.Now()
+		s.Events <- event
+	}
+}
+
+// recentRestarts returns the restarts that still count against `MaxRestarts`
+// at time now.
+func (s *Supervisor) recentRestarts(restarts []time.Time, now time.Time) []time.Time {
+	if s.RestartWindow <= 0 {
+		return restarts
+	}
+	var i = 0
+	for i < len(restarts) && now.Sub(restarts[i]) > s.RestartWindow {
+		i++
+	}
+	return restarts[i:]
+}
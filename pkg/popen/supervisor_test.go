@@ -0,0 +1,106 @@
+package popen_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maargenton/go-testpredicate/pkg/verify"
+
+	"github.com/maargenton/go-fileutils"
+	"github.com/maargenton/go-fileutils/pkg/popen"
+)
+
+func collectEvents(events <-chan popen.SupervisorEvent) (types []string) {
+	for event := range events {
+		types = append(types, event.Type.String())
+	}
+	return
+}
+
+func TestSupervisorMaxRestarts(t *testing.T) {
+	var events = make(chan popen.SupervisorEvent, 100)
+	var s = popen.Supervisor{
+		Command: popen.Command{
+			Command:   "bash",
+			Arguments: []string{"-c", "exit 3"},
+		},
+		Restart:        popen.RestartOnFailure,
+		MaxRestarts:    2,
+		RestartWindow:  time.Minute,
+		InitialBackoff: time.Millisecond,
+		Jitter:         0.5,
+		Events:         events,
+	}
+	err := s.Run(context.Background())
+	verify.That(t, err).IsError(popen.ErrTooManyRestarts)
+	verify.That(t, err).ToString().Contains("exit status 3")
+	verify.That(t, collectEvents(events)).Eq([]string{
+		"started", "exited", "restarting",
+		"started", "exited", "restarting",
+		"started", "exited", "stopped",
+	})
+}
+
+func TestSupervisorRestartOnFailure(t *testing.T) {
+	var tmp = tempDir(t)
+	var counter = fileutils.Join(tmp, "counter")
+	var s = popen.Supervisor{
+		Command: popen.Command{
+			Command: "bash",
+			Arguments: []string{"-c", `
+				n=$(cat ` + counter + ` 2>/dev/null || echo 0)
+				echo $((n+1)) > ` + counter + `
+				[ $n -ge 2 ]`},
+		},
+		Restart:        popen.RestartOnFailure,
+		InitialBackoff: time.Millisecond,
+	}
+	err := s.Run(context.Background())
+	verify.That(t, err).IsError(nil)
+	verify.That(t, readFile(t, counter)).Eq("3\n")
+}
+
+func TestSupervisorRestartAlways(t *testing.T) {
+	var events = make(chan popen.SupervisorEvent, 100)
+	var s = popen.Supervisor{
+		Command: popen.Command{
+			Command: "true",
+		},
+		MaxRestarts:    3,
+		InitialBackoff: time.Millisecond,
+		Events:         events,
+	}
+	err := s.Run(context.Background())
+	verify.That(t, err).IsError(popen.ErrTooManyRestarts)
+
+	var restarts []popen.SupervisorEvent
+	for event := range events {
+		if event.Type == popen.CommandRestarting {
+			restarts = append(restarts, event)
+		}
+	}
+	verify.That(t, restarts).Length().Eq(3)
+	verify.That(t, restarts[0].Backoff.Seconds()).Eq(0.001)
+	verify.That(t, restarts[2].Backoff.Seconds()).Eq(0.004)
+}
+
+func TestSupervisorShutdownOnCancel(t *testing.T) {
+	var events = make(chan popen.SupervisorEvent, 100)
+	var s = popen.Supervisor{
+		Command: popen.Command{
+			Command:             "sleep",
+			Arguments:           []string{"10"},
+			ShutdownGracePeriod: time.Second,
+		},
+		Events: events,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var start = time.Now()
+	err := s.Run(ctx)
+	verify.That(t, err).IsError(context.DeadlineExceeded)
+	verify.That(t, time.Since(start).Seconds()).Lt(5.0)
+	verify.That(t, collectEvents(events)).Eq([]string{"started", "exited", "stopped"})
+}